@@ -0,0 +1,83 @@
+package uncurl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// flagOAuth2Bearer handles --oauth2-bearer, sending the token as a Bearer Authorization header unless
+// one is given with -H
+func (un *Uncurl) flagOAuth2Bearer(flag, arg string) error {
+	un.deferHeader("Authorization", "Bearer "+arg)
+	return nil
+}
+
+// flagUser handles -u, sending the credentials as a Basic Authorization header as curl does, unless
+// one is given with -H. Only the first colon separates the user from the password, and a user given
+// alone has an empty password rather than the prompt curl would show.
+func (un *Uncurl) flagUser(flag, arg string) error {
+	if !strings.Contains(arg, ":") {
+		arg += ":"
+	}
+	un.deferHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(arg)))
+	return nil
+}
+
+// BasicAuth returns the username and password of a Basic Authorization header, whether it was given
+// with -H or -u, mirroring http.Request.BasicAuth
+func (un *Uncurl) BasicAuth() (username, password string, ok bool) {
+	r := http.Request{Header: http.Header{"Authorization": {un.headerGet("Authorization")}}}
+	return r.BasicAuth()
+}
+
+// BearerToken returns the token of a `Bearer` Authorization header, whether it was given with -H or
+// --oauth2-bearer, or "" if there is none
+func (un *Uncurl) BearerToken() string {
+	a := un.headerGet("Authorization")
+	if len(a) > 7 && strings.EqualFold(a[:7], "bearer ") {
+		return strings.TrimSpace(a[7:])
+	}
+	return ""
+}
+
+// AuthScheme returns the scheme of the Authorization header, "Bearer" or "Basic" for those schemes
+// however they were cased and the scheme token as written otherwise, or "" if there is no header
+func (un *Uncurl) AuthScheme() string {
+	a := strings.TrimSpace(un.headerGet("Authorization"))
+	if i := strings.IndexAny(a, " \t"); i >= 0 {
+		a = a[:i]
+	}
+	switch {
+	case strings.EqualFold(a, "Bearer"):
+		return "Bearer"
+	case strings.EqualFold(a, "Basic"):
+		return "Basic"
+	}
+	return a
+}
+
+// JWTClaims decodes the claims of a JWT carried as the Bearer token, without verifying its signature.
+// It returns an error if there is no Bearer token or it is not a JWT.
+func (un *Uncurl) JWTClaims() (map[string]interface{}, error) {
+	tok := un.BearerToken()
+	if tok == "" {
+		return nil, errors.New("No Bearer token in Authorization header")
+	}
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Bearer token is not a JWT: found %d dot-separated parts, expected 3", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("Bearer token is not a JWT: payload is not base64url: %s", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Bearer token is not a JWT: payload is not a JSON object: %s", err)
+	}
+	return claims, nil
+}
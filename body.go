@@ -0,0 +1,202 @@
+package uncurl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// GraphQL parses a GraphQL-over-HTTP JSON body, returning its query and variables. ok is false if the
+// body is not a JSON object with a non-empty string `query` member.
+func (un *Uncurl) GraphQL() (query string, variables map[string]interface{}, ok bool) {
+	var op struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := json.Unmarshal(un.body, &op); err != nil || op.Query == "" {
+		return "", nil, false
+	}
+	return op.Query, op.Variables, true
+}
+
+// BodyBase64 returns the body encoded as standard base64, for embedding binary bodies in YAML or JSON
+// configuration
+func (un *Uncurl) BodyBase64() string {
+	return base64.StdEncoding.EncodeToString(un.body)
+}
+
+// SetBodyBase64 replaces the body with the decoded standard base64 string s, as produced by
+// BodyBase64. An empty s removes the body. The method is left unchanged.
+func (un *Uncurl) SetBodyBase64(s string) error {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("Failed to decode base64 body: %s", err)
+	}
+	un.setBody(b)
+	return nil
+}
+
+// setBody replaces the body, sending it verbatim in re-emitted commands. A zero-length b removes it.
+// A captured Content-Length is dropped, since it described the old body; requests and RawHTTP carry
+// the length of the new one.
+func (un *Uncurl) setBody(b []byte) {
+	un.delHeader("Content-Length")
+	if len(b) == 0 {
+		un.body, un.rawData, un.dataFlag = nil, nil, ""
+		return
+	}
+	un.body, un.rawData = b, b
+	if un.dataFlag != "--data-raw" {
+		un.dataFlag = verbatimDataFlag(b)
+	}
+}
+
+// SetJSONField sets the field at the dotted path, such as "user.id", in the JSON body to value and
+// re-encodes the body. Numeric segments index into arrays, and missing object fields are created.
+// Object keys come out sorted, and numbers keep their original text. It returns an error if the body
+// is not JSON or the path runs through a value that is neither an object nor an array.
+func (un *Uncurl) SetJSONField(path string, value interface{}) error {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(un.body))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return fmt.Errorf("Body is not JSON: %s", err)
+	}
+	if path == "" {
+		return fmt.Errorf("Empty JSON path")
+	}
+	doc, err := setJSONPath(doc, strings.Split(path, "."), value)
+	if err != nil {
+		return fmt.Errorf("Invalid JSON path %s: %s", path, err)
+	}
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return fmt.Errorf("Failed to encode JSON body: %s", err)
+	}
+	un.setBody(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
+
+// setJSONPath returns doc with the value at path set to value
+func setJSONPath(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	seg := path[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		e, err := setJSONPath(v[seg], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[seg] = e
+		return v, nil
+	case []interface{}:
+		i, err := strconv.Atoi(seg)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("no index %s in array of length %d", seg, len(v))
+		}
+		e, err := setJSONPath(v[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = e
+		return v, nil
+	case nil:
+		e, err := setJSONPath(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{seg: e}, nil
+	}
+	return nil, fmt.Errorf("cannot set field %s of %T", seg, doc)
+}
+
+// MultipartPart is one part of a multipart request body
+type MultipartPart struct {
+	// Header holds the part's own headers, such as Content-Disposition
+	Header textproto.MIMEHeader
+
+	// Name and FileName are taken from the Content-Disposition header, if present
+	Name     string
+	FileName string
+
+	Content []byte
+}
+
+// MultipartParts splits a multipart body into its parts, using the boundary from the captured
+// Content-Type header. It returns an error if the Content-Type is not multipart or the body is
+// malformed.
+func (un *Uncurl) MultipartParts() ([]MultipartPart, error) {
+	ct := un.headerGet("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("Body is not multipart, Content-Type is %q", ct)
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("No boundary in Content-Type %q", ct)
+	}
+	mr := multipart.NewReader(bytes.NewReader(un.body), params["boundary"])
+	var parts []MultipartPart
+	for {
+		p, err := mr.NextPart() // NextRawPart needs Go 1.14; NextPart only differs for quoted-printable parts
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading multipart body: %s", err)
+		}
+		content, err := ioutil.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading multipart body: %s", err)
+		}
+		parts = append(parts, MultipartPart{
+			Header:   p.Header,
+			Name:     p.FormName(),
+			FileName: p.FileName(),
+			Content:  content,
+		})
+	}
+}
+
+// binaryMediaTypes are the non-wildcard media types IsBinaryBody treats as binary
+var binaryMediaTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/pdf":          true,
+	"application/zip":          true,
+	"application/gzip":         true,
+	"application/protobuf":     true,
+	"application/x-protobuf":   true,
+	"application/grpc":         true,
+	"application/wasm":         true,
+}
+
+// IsBinaryBody reports whether the body should be treated as binary, for instance to keep it out of
+// logs: when the Content-Type is an image, audio, video or font type or another known binary type such
+// as application/octet-stream, or when the body is not valid UTF-8
+func (un *Uncurl) IsBinaryBody() bool {
+	if len(un.body) == 0 {
+		return false
+	}
+	if mediaType, _, err := mime.ParseMediaType(un.headerGet("Content-Type")); err == nil {
+		switch strings.SplitN(mediaType, "/", 2)[0] {
+		case "image", "audio", "video", "font":
+			return true
+		}
+		if binaryMediaTypes[mediaType] {
+			return true
+		}
+	}
+	return !utf8.Valid(un.body)
+}
@@ -0,0 +1,123 @@
+package uncurl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// maxConfigDepth bounds how deeply config files may include further config files
+const maxConfigDepth = 8
+
+func init() {
+	// registered here rather than in the curlFlags literal, as reading a config walks curlFlags
+	curlFlags["-K"] = &flagSpec{hasArg: true, handle: (*Uncurl).flagConfig}
+	curlFlags["--config"] = curlFlags["-K"]
+}
+
+// flagConfig handles -K/--config, merging the options of the named curl config file. The file is only
+// read with WithFileReads, which is off by default for untrusted input; if it is not read, a warning
+// naming that option is recorded and parsing carries on with the rest of the command. Warnings raised by the file's options do not quote them, as it may not be meant for
+// curl at all.
+func (un *Uncurl) flagConfig(flag, arg string) error {
+	if !un.opts.fileReads {
+		un.warn("Not reading config file %s; enable file reads with WithFileReads", arg)
+		return nil
+	}
+	if un.configDepth >= maxConfigDepth {
+		return fmt.Errorf("Config files nested more than %d deep at %s", maxConfigDepth, arg)
+	}
+	b, err := ioutil.ReadFile(arg)
+	if err != nil {
+		un.warn("Failed to read config file %s: %s", arg, err)
+		return nil
+	}
+	toks, err := tokenizeConfig(b)
+	if err != nil {
+		return fmt.Errorf("Config file %s: %s", arg, err)
+	}
+	if un.configDepth == 0 {
+		un.configName = arg
+	}
+	un.configDepth++
+	defer func() { un.configDepth-- }()
+	if err := un.walk(toks, b); err != nil {
+		return fmt.Errorf("Config file %s: %s", arg, err)
+	}
+	return nil
+}
+
+// tokenizeConfig turns a curl config file into flag tokens. Each line holds one option, with or without
+// leading dashes for long options, optionally followed by `=`, `:` or whitespace and a value, which may
+// be double-quoted with backslash escapes. Blank lines and lines starting with `#` are skipped.
+func tokenizeConfig(b []byte) ([]token, error) {
+	var toks []token
+	off := 0
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		lineOff := off
+		off += len(line) + 1
+		s := strings.TrimSpace(string(line))
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		lineOff += strings.Index(string(line), s)
+		name, rest := s, ""
+		if i := strings.IndexAny(s, " \t=:"); i >= 0 {
+			name, rest = s[:i], strings.TrimLeft(s[i:], " \t")
+			if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+				rest = strings.TrimLeft(rest[1:], " \t")
+			}
+		}
+		if name[0] != '-' {
+			name = "--" + name
+		}
+		toks = append(toks, token{val: name, offset: lineOff})
+		if rest == "" {
+			continue
+		}
+		val, err := configValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", err, position(b, lineOff))
+		}
+		toks = append(toks, token{val: val, offset: lineOff + len(s) - len(rest), optionValue: true})
+	}
+	return toks, nil
+}
+
+// configValue decodes the value part of a config file line
+func configValue(s string) (string, error) {
+	if s[0] != '"' {
+		if i := strings.IndexAny(s, " \t"); i >= 0 {
+			return s[:i], nil
+		}
+		return s, nil
+	}
+	var v []byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return string(v), nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			switch s[i] {
+			case 't':
+				v = append(v, '\t')
+			case 'n':
+				v = append(v, '\n')
+			case 'r':
+				v = append(v, '\r')
+			case 'v':
+				v = append(v, '\v')
+			default:
+				v = append(v, s[i])
+			}
+		default:
+			v = append(v, c)
+		}
+	}
+	return "", fmt.Errorf("Unterminated double quote")
+}
@@ -0,0 +1,157 @@
+package uncurl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieHeaderParts returns each `name=value` segment of the captured Cookie header as a separate,
+// trimmed string, preserving the exact text of each segment
+func (un *Uncurl) CookieHeaderParts() []string {
+	var parts []string
+	for _, v := range un.headerValues("Cookie") {
+		for _, p := range strings.Split(v, ";") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	return parts
+}
+
+// AddCookie attaches a copy of c to the requests generated from the Uncurl, in addition to any Cookie
+// header captured in the curl string. It is the way to bring in cookies that carry an expiry, such as
+// those from a cookie jar or HAR capture. A cookie whose name is already sent is left out.
+func (un *Uncurl) AddCookie(c *http.Cookie) {
+	cc := *c
+	un.cookies = append(un.cookies, &cc)
+}
+
+// ExpiredCookies returns the attached cookies whose Expires time is before now, so a replay can avoid
+// silently sending stale credentials. Cookies without an expiry, including all cookies from the
+// curl string itself, are never expired.
+func (un *Uncurl) ExpiredCookies(now time.Time) []*http.Cookie {
+	var expired []*http.Cookie
+	for _, c := range un.cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			cc := *c
+			expired = append(expired, &cc)
+		}
+	}
+	return expired
+}
+
+// Cookies returns the cookies the request sends: those of the captured Cookie header, then those from
+// -b or AddCookie, apart from any whose name is already among them
+func (un *Uncurl) Cookies() []*http.Cookie {
+	r := http.Request{Header: http.Header{"Cookie": un.headerValues("Cookie")}}
+	return append(r.Cookies(), un.addedCookies()...)
+}
+
+// addedCookies returns copies of the cookies from -b or AddCookie, leaving out those whose name is taken
+// by the captured Cookie header or an earlier cookie, so the two ways of giving cookies merge
+func (un *Uncurl) addedCookies() []*http.Cookie {
+	r := http.Request{Header: http.Header{"Cookie": un.headerValues("Cookie")}}
+	seen := make(map[string]bool)
+	for _, c := range r.Cookies() {
+		seen[c.Name] = true
+	}
+	var added []*http.Cookie
+	for _, c := range un.cookies {
+		if seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		cc := *c
+		added = append(added, &cc)
+	}
+	return added
+}
+
+// addCookies adds the cookies from -b or AddCookie to r. AddCookie only extends a Cookie header under
+// its canonical key, so a captured header of another casing is moved there first.
+func (un *Uncurl) addCookies(r *http.Request) {
+	added := un.addedCookies()
+	if len(added) == 0 {
+		return
+	}
+	for k, v := range r.Header {
+		if k != "Cookie" && strings.EqualFold(k, "Cookie") {
+			delete(r.Header, k)
+			r.Header["Cookie"] = append(r.Header["Cookie"], v...)
+		}
+	}
+	for _, c := range added {
+		r.AddCookie(c)
+	}
+}
+
+// addedCookieString returns the cookies from -b or AddCookie in the `name=value; name2=value2` form of a
+// Cookie header, or "" if there are none
+func (un *Uncurl) addedCookieString() string {
+	var pairs []string
+	for _, c := range un.addedCookies() {
+		pairs = append(pairs, (&http.Cookie{Name: c.Name, Value: c.Value}).String())
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// headerWithCookies returns a copy of the captured headers with the cookies from -b or AddCookie added
+// to the Cookie header as requests carry them, for renderers that have no separate place for cookies
+func (un *Uncurl) headerWithCookies() map[string][]string {
+	h := make(map[string][]string, len(un.header)+1)
+	for k, v := range un.header {
+		h[k] = append([]string(nil), v...)
+	}
+	added := un.addedCookieString()
+	if added == "" {
+		return h
+	}
+	for k, v := range h {
+		if strings.EqualFold(k, "Cookie") && len(v) > 0 {
+			if last := len(v) - 1; v[last] != "" {
+				v[last] += "; " + added
+			} else {
+				v[last] = added
+			}
+			return h
+		}
+	}
+	h["Cookie"] = []string{added}
+	return h
+}
+
+// flagCookie handles -b. An argument holding a `=` is a `name=value; name2=value2` list of cookies.
+// With `@-` such lists are read from the WithStdin reader, one line at a time, skipping blank lines and
+// # comments. Any other argument names a cookie file, which is not read and is recorded as ignored.
+func (un *Uncurl) flagCookie(flag, arg string) error {
+	if strings.Contains(arg, "=") {
+		un.recordOrder("cookie")
+		r := http.Request{Header: http.Header{"Cookie": {arg}}}
+		un.cookies = append(un.cookies, r.Cookies()...)
+		return nil
+	}
+	if arg != "@-" {
+		return un.flagIgnored(flag, arg)
+	}
+	if un.opts.stdin == nil {
+		return fmt.Errorf("Flag %s %s reads cookies from stdin, but no reader was given with WithStdin", flag, arg)
+	}
+	b, err := ioutil.ReadAll(un.opts.stdin)
+	if err != nil {
+		return fmt.Errorf("Failed to read cookies from stdin for flag %s: %s", flag, err)
+	}
+	var lines []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	un.recordOrder("cookie")
+	r := http.Request{Header: http.Header{"Cookie": lines}}
+	un.cookies = append(un.cookies, r.Cookies()...)
+	return nil
+}
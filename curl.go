@@ -0,0 +1,398 @@
+package uncurl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Curl renders the request as a curl command line quoted for a POSIX shell. Flags are emitted in the
+// order they appeared in the original curl string, with anything added since, such as a header from
+// MergeHeaders, following in the order CanonicalCurl uses. Accept-Encoding is re-emitted if it was
+// captured, as is --compressed, and the cookies from -b or AddCookie are joined into a single -b. The
+// proxy, --resolve, --interface, -m, --max-redirs, -k, -L and -i flags are re-emitted too. Flags that
+// leave the request alone, such as -s, -v, -o and --trace, and unsupported ones such as -F are not;
+// neither are -K config files, whose options are emitted as if given directly. Flags that set a
+// header, such as -u, -A and -r, are emitted as that header.
+func (un *Uncurl) Curl() string {
+	return un.curl(false, true, nil)
+}
+
+// CanonicalCurl is like Curl, but in a normalized order whatever the original: the target, -X if the
+// method is not the one curl implies, the headers sorted by name, -b, the body using the flag it was
+// captured with, --compressed, then the connection flags in the order Curl lists them
+func (un *Uncurl) CanonicalCurl() string {
+	return un.curl(false, false, nil)
+}
+
+// CurlCompat is like Curl, but restricted to long-standing curl flags for use with old curl versions.
+// In particular a body captured with --data-raw or --json, which old curl lacks, is given with
+// --data-binary rather than plain --data: both exist in every curl, but --data strips carriage returns
+// and newlines, so it would not send the captured body verbatim. A body starting with `@`, which
+// --data-binary would take as a file to read, is piped in on standard input with printf and given as
+// --data-binary @-.
+func (un *Uncurl) CurlCompat() string {
+	return un.curl(true, true, nil)
+}
+
+// minimalCurlHeaders are the headers MinimalCurl keeps
+var minimalCurlHeaders = map[string]bool{
+	"accept":        true,
+	"authorization": true,
+	"content-type":  true,
+}
+
+// MinimalCurl is like Curl, but keeps only the essential Accept, Authorization and Content-Type
+// headers, dropping browser noise such as sec-*, user-agent and accept-language. It yields a shorter
+// command to share as a reproduction.
+func (un *Uncurl) MinimalCurl() string {
+	return un.curl(false, true, func(k string) bool {
+		return minimalCurlHeaders[strings.ToLower(k)]
+	})
+}
+
+// curl renders the command on one line, restricted to old curl flags if compat is set, in the
+// original flag order if ordered is set and to the headers accepted by keep if it is not nil
+func (un *Uncurl) curl(compat, ordered bool, keep func(k string) bool) string {
+	quote := quoteEach(shellQuote)
+	if ordered {
+		quote = un.quoteAsCaptured
+	}
+	cmd := strings.Join(un.curlArgs(quote, compat, ordered, keep), " ")
+	if un.stdinBody(compat) {
+		cmd = "printf '%s' " + quote("data", string(un.body)) + " | " + cmd
+	}
+	return cmd
+}
+
+// stdinBody reports whether the body is rendered as --data-binary @-, to be piped in on standard input:
+// in compat mode, for a body starting with the `@` that only --data-raw sends literally
+func (un *Uncurl) stdinBody(compat bool) bool {
+	return compat && un.body != nil && un.emittedDataFlag(compat) == "--data-raw"
+}
+
+// quoteEach adapts a quoting function to the form curlArgs takes, quoting every argument alike
+func quoteEach(quote func(string) string) func(key, s string) string {
+	return func(key, s string) string {
+		return quote(s)
+	}
+}
+
+// quoteAsCaptured quotes s for a POSIX shell in the style the argument of the flag ordered by key was
+// captured with: double quotes for a double-quoted argument, none for a bare one that needs none, and
+// single quotes otherwise, including for ANSI-C quoted arguments and flags added since capture
+func (un *Uncurl) quoteAsCaptured(key, s string) string {
+	switch un.argKinds[key] {
+	case TokenDoubleQuoted:
+		return doubleQuote(s)
+	case TokenBare:
+		if _, captured := un.argKinds[key]; captured && s != "" && strings.Trim(s, shellSafeChars) == "" {
+			return s
+		}
+	}
+	return shellQuote(s)
+}
+
+// shellSafeChars are the characters a bare POSIX shell word may hold without quoting
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-"
+
+// doubleQuote double-quotes s for a POSIX shell, escaping the characters that keep their meaning in
+// double quotes
+func doubleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`").Replace(s) + `"`
+}
+
+// curlArg is one piece of a rendered command, with the key it is ordered by. The target has no flag,
+// and --compressed no value.
+type curlArg struct {
+	key      string
+	flag     string
+	value    string
+	hasValue bool
+}
+
+// curlArgs returns the pieces of the rendered command: the curl name and the first flag or the target,
+// then each further flag with its argument quoted by quote
+func (un *Uncurl) curlArgs(quote func(key, s string) string, compat, ordered bool, keep func(k string) bool) []string {
+	args := []curlArg{{"url", "", un.target, true}}
+	if un.method != un.impliedMethod() {
+		args = append(args, curlArg{"method", "-X", un.method, true})
+	}
+	for _, k := range un.headerKeys() {
+		if keep != nil && !keep(k) {
+			continue
+		}
+		for _, v := range un.header[k] {
+			args = append(args, curlArg{headerOrderKey(k), "-H", k + ": " + v, true})
+		}
+	}
+	if un.AcceptEncoding != "" && un.headerValues("Accept-Encoding") == nil && keep == nil {
+		args = append(args, curlArg{headerOrderKey("Accept-Encoding"), "-H", "Accept-Encoding: " + un.AcceptEncoding, true})
+	}
+	if cookies := un.addedCookieString(); cookies != "" && (keep == nil || keep("Cookie")) {
+		args = append(args, curlArg{"cookie", "-b", cookies, true})
+	}
+	if un.body != nil {
+		if un.stdinBody(compat) {
+			args = append(args, curlArg{"data", "--data-binary", "@-", true})
+		} else {
+			args = append(args, curlArg{"data", un.emittedDataFlag(compat), string(un.body), true})
+		}
+	}
+	if un.compressed {
+		args = append(args, curlArg{key: "compressed", flag: "--compressed"})
+	}
+	for _, p := range un.proxies {
+		args = append(args, curlArg{"proxy", p.flag, p.url, true})
+	}
+	for _, re := range un.resolves {
+		args = append(args, curlArg{"resolve", "--resolve", re.String(), true})
+	}
+	if un.iface != "" {
+		args = append(args, curlArg{"interface", "--interface", un.iface, true})
+	}
+	if un.maxTime > 0 {
+		args = append(args, curlArg{"max-time", "-m", strconv.FormatFloat(un.maxTime.Seconds(), 'f', -1, 64), true})
+	}
+	if un.hasMaxRedirs {
+		args = append(args, curlArg{"max-redirs", "--max-redirs", strconv.Itoa(un.maxRedirs), true})
+	}
+	for _, f := range []struct {
+		given bool
+		key   string
+		flag  string
+	}{{un.insecure, "insecure", "-k"}, {un.location, "location", "-L"}, {un.includeHeaders, "include", "-i"}} {
+		if f.given {
+			args = append(args, curlArg{key: f.key, flag: f.flag})
+		}
+	}
+	if ordered {
+		rank := make(map[string]int, len(un.order))
+		for i, k := range un.order {
+			rank[k] = i
+		}
+		sort.SliceStable(args, func(i, j int) bool {
+			ri, ok := rank[args[i].key]
+			if !ok {
+				ri = len(un.order)
+			}
+			rj, ok := rank[args[j].key]
+			if !ok {
+				rj = len(un.order)
+			}
+			return ri < rj
+		})
+	}
+	out := make([]string, len(args))
+	for i, a := range args {
+		switch {
+		case a.flag == "":
+			out[i] = quote(a.key, a.value)
+		case a.hasValue:
+			out[i] = a.flag + " " + quote(a.key, a.value)
+		default:
+			out[i] = a.flag
+		}
+	}
+	out[0] = "curl " + out[0]
+	return out
+}
+
+// emittedDataFlag returns the flag the body is re-emitted with: the one it was captured with, or in
+// compat mode or if there is none, --data-binary, or --data-raw for a body --data-binary would read
+// from a file
+func (un *Uncurl) emittedDataFlag(compat bool) string {
+	switch un.dataFlag {
+	case "--data-raw", "--json":
+		if !compat {
+			return un.dataFlag
+		}
+	case "":
+	default:
+		return un.dataFlag
+	}
+	return verbatimDataFlag(un.body)
+}
+
+// verbatimDataFlag returns --data-binary, or --data-raw if b starts with the `@` that makes
+// --data-binary read a file
+func verbatimDataFlag(b []byte) string {
+	if len(b) > 0 && b[0] == '@' {
+		return "--data-raw"
+	}
+	return "--data-binary"
+}
+
+// headerOrderKey is the key the flags of header k are ordered by
+func headerOrderKey(k string) string {
+	return "header:" + strings.ToLower(k)
+}
+
+// recordOrder notes that the flag ordered by key was given, if it was not already, so Curl can emit
+// flags in their original order
+func (un *Uncurl) recordOrder(key string) {
+	for _, k := range un.order {
+		if k == key {
+			return
+		}
+	}
+	un.order = append(un.order, key)
+	if un.argKinds == nil {
+		un.argKinds = make(map[string]TokenKind)
+	}
+	un.argKinds[key] = un.argKind
+}
+
+// PrettyCurl is like Curl, but spreads the command over several lines joined by backslash
+// continuations, with each flag on its own indented line as commands are usually formatted in docs
+func (un *Uncurl) PrettyCurl() string {
+	return strings.Join(un.curlArgs(un.quoteAsCaptured, false, true, nil), " \\\n  ")
+}
+
+// Shell selects the quoting CurlForShell renders a command with
+type Shell int
+
+const (
+	// ShellBash is POSIX shell quoting, as used by Curl
+	ShellBash Shell = iota
+
+	// ShellCmd is Windows cmd.exe quoting, as in Chrome's "Copy as cURL (cmd)"
+	ShellCmd
+
+	// ShellPowerShell is PowerShell quoting, calling curl.exe so as not to reach the curl alias of
+	// Invoke-WebRequest
+	ShellPowerShell
+)
+
+// CurlForShell is like Curl, but quoted to be pasted into shell. Each format parses back to the same
+// request.
+func (un *Uncurl) CurlForShell(shell Shell) string {
+	switch shell {
+	case ShellCmd:
+		return strings.Join(un.curlArgs(quoteEach(cmdQuote), false, true, nil), " ")
+	case ShellPowerShell:
+		return "curl.exe" + strings.TrimPrefix(strings.Join(un.curlArgs(quoteEach(powerShellQuote), false, true, nil), " "), "curl")
+	}
+	return un.Curl()
+}
+
+// impliedMethod returns the method curl uses when no -X flag is given
+func (un *Uncurl) impliedMethod() string {
+	if un.body != nil {
+		return `POST`
+	}
+	return `GET`
+}
+
+// shellQuote single-quotes s for a POSIX shell, closing and reopening the quotes around an escaped
+// quote for each embedded single quote
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// cmdQuote quotes s for cmd.exe as Chrome does: the argument is escaped for the Microsoft C runtime,
+// with backslashes doubled only before a quote, then wrapped in ^" and every character cmd.exe treats
+// specially is escaped with a caret. A newline becomes a caret continuation followed by the newline
+// itself.
+func cmdQuote(s string) string {
+	var crt []byte
+	for i := 0; i < len(s); i++ {
+		n := 0
+		for i < len(s) && s[i] == '\\' {
+			n++
+			i++
+		}
+		switch {
+		case i == len(s):
+			crt = append(crt, strings.Repeat(`\`, 2*n)...)
+			continue
+		case s[i] == '"':
+			crt = append(crt, strings.Repeat(`\`, 2*n+1)...)
+		default:
+			crt = append(crt, strings.Repeat(`\`, n)...)
+		}
+		crt = append(crt, s[i])
+	}
+	var b strings.Builder
+	b.WriteString(`^"`)
+	for _, c := range crt {
+		switch {
+		case c == '\n' || c == '\r':
+			b.WriteString("^\n")
+		case c >= 0x80 || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.IndexByte(" \t_-:=+~'/.,?;()*", c) >= 0:
+		default:
+			b.WriteByte('^')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString(`^"`)
+	return b.String()
+}
+
+// powerShellQuote single-quotes s for PowerShell, doubling each embedded single quote
+func powerShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// RawHTTP renders the request as it would be written on an HTTP/1.1 connection: the request line, a
+// Host header, which a captured authority header sets, the other captured headers in sorted order with
+// their original key casing and the -b cookies added to the Cookie header, a Content-Length when there
+// is a body, and the body itself
+func (un *Uncurl) RawHTTP() []byte {
+	var b bytes.Buffer
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return nil
+	}
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", un.method, u.RequestURI())
+	h := un.headerWithCookies()
+	host := un.authorityHost(h)
+	if host == "" {
+		host = u.Host
+	}
+	if un.headerValues("Host") == nil {
+		fmt.Fprintf(&b, "Host: %s\r\n", host)
+	}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	if un.body != nil && un.headerValues("Content-Length") == nil {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(un.body))
+	}
+	b.WriteString("\r\n")
+	b.Write(un.body)
+	return b.Bytes()
+}
+
+// Golden renders a stable multi-line summary of the request for golden-file tests: the method and URL,
+// each header as a sorted "Key: value" line (Accept-Encoding and -b cookies included), and the body's
+// length and SHA-256 digest
+func (un *Uncurl) Golden() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", un.method, un.target)
+	var lines []string
+	for k, v := range un.headerWithCookies() {
+		for _, s := range v {
+			lines = append(lines, k+": "+s)
+		}
+	}
+	sort.Strings(lines)
+	if un.AcceptEncoding != "" && un.headerValues("Accept-Encoding") == nil {
+		lines = append(lines, "Accept-Encoding: "+un.AcceptEncoding)
+		sort.Strings(lines)
+	}
+	for _, l := range lines {
+		b.WriteString(l + "\n")
+	}
+	sum := sha256.Sum256(un.body)
+	fmt.Fprintf(&b, "Body: %d bytes sha256:%s\n", len(un.body), hex.EncodeToString(sum[:]))
+	return b.String()
+}
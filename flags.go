@@ -0,0 +1,511 @@
+package uncurl
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// flagSpec describes how the flag walker treats a curl flag
+type flagSpec struct {
+	// hasArg is true when the flag consumes the following token (or the rest of a short flag token)
+	hasArg bool
+
+	// handle applies the flag to the Uncurl being built. A nil handle means the flag is accepted
+	// silently; flags that are understood but have no effect on the request use flagIgnored instead.
+	handle func(un *Uncurl, flag, arg string) error
+}
+
+// curlFlags maps each recognized short and long flag to its spec
+var curlFlags = map[string]*flagSpec{
+	"-H":                {hasArg: true, handle: (*Uncurl).flagHeader},
+	"--header":          {hasArg: true, handle: (*Uncurl).flagHeader},
+	"-X":                {hasArg: true, handle: (*Uncurl).flagMethod},
+	"--request":         {hasArg: true, handle: (*Uncurl).flagMethod},
+	"-d":                {hasArg: true, handle: (*Uncurl).flagData},
+	"--data":            {hasArg: true, handle: (*Uncurl).flagData},
+	"--data-raw":        {hasArg: true, handle: (*Uncurl).flagData},
+	"--data-ascii":      {hasArg: true, handle: (*Uncurl).flagData},
+	"--data-binary":     {hasArg: true, handle: (*Uncurl).flagData},
+	"--data-urlencode":  {hasArg: true, handle: (*Uncurl).flagDataURLEncode},
+	"--json":            {hasArg: true, handle: (*Uncurl).flagJSON},
+	"--url":             {hasArg: true, handle: (*Uncurl).flagURL},
+	"-x":                {hasArg: true, handle: (*Uncurl).flagProxy},
+	"--proxy":           {hasArg: true, handle: (*Uncurl).flagProxy},
+	"--preproxy":        {hasArg: true, handle: (*Uncurl).flagProxy},
+	"-r":                {hasArg: true, handle: (*Uncurl).flagRange},
+	"--range":           {hasArg: true, handle: (*Uncurl).flagRange},
+	"--max-redirs":      {hasArg: true, handle: (*Uncurl).flagMaxRedirs},
+	"--interface":       {hasArg: true, handle: (*Uncurl).flagInterface},
+	"-m":                {hasArg: true, handle: (*Uncurl).flagMaxTime},
+	"--max-time":        {hasArg: true, handle: (*Uncurl).flagMaxTime},
+	"--compressed":      {handle: (*Uncurl).flagCompressed},
+	"--resolve":         {hasArg: true, handle: (*Uncurl).flagResolve},
+	"--oauth2-bearer":   {hasArg: true, handle: (*Uncurl).flagOAuth2Bearer},
+	"-u":                {hasArg: true, handle: (*Uncurl).flagUser},
+	"--user":            {hasArg: true, handle: (*Uncurl).flagUser},
+	"-b":                {hasArg: true, handle: (*Uncurl).flagCookie},
+	"--cookie":          {hasArg: true, handle: (*Uncurl).flagCookie},
+	"-i":                {handle: (*Uncurl).flagInclude},
+	"--include":         {handle: (*Uncurl).flagInclude},
+	"-O":                {handle: (*Uncurl).flagIgnored},
+	"--remote-name":     {handle: (*Uncurl).flagIgnored},
+	"-k":                {handle: (*Uncurl).flagInsecure},
+	"--insecure":        {handle: (*Uncurl).flagInsecure},
+	"-s":                {handle: (*Uncurl).flagIgnored},
+	"--silent":          {handle: (*Uncurl).flagIgnored},
+	"-v":                {handle: (*Uncurl).flagIgnored},
+	"--verbose":         {handle: (*Uncurl).flagIgnored},
+	"-S":                {handle: (*Uncurl).flagIgnored},
+	"--show-error":      {handle: (*Uncurl).flagIgnored},
+	"-L":                {handle: (*Uncurl).flagLocation},
+	"--location":        {handle: (*Uncurl).flagLocation},
+	"-o":                {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--output":          {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--trace":           {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--trace-ascii":     {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-A":                {hasArg: true, handle: (*Uncurl).flagUserAgent},
+	"--user-agent":      {hasArg: true, handle: (*Uncurl).flagUserAgent},
+	"-e":                {hasArg: true, handle: (*Uncurl).flagReferer},
+	"--referer":         {hasArg: true, handle: (*Uncurl).flagReferer},
+	"-F":                {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--form":            {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--form-string":     {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"-T":                {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--upload-file":     {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--connect-to":      {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--request-target":  {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--url-query":       {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--proxy-header":    {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--aws-sigv4":       {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"-z":                {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--time-cond":       {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"-C":                {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--continue-at":     {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--etag-compare":    {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--unix-socket":     {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--socks5":          {hasArg: true, handle: (*Uncurl).flagUnsupported},
+	"--socks5-hostname": {hasArg: true, handle: (*Uncurl).flagUnsupported},
+
+	// flags taking an argument that only affect how curl connects, retries or reports
+	"--connect-timeout":   {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--retry":             {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--retry-delay":       {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--retry-max-time":    {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--keepalive-time":    {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--limit-rate":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-y":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--speed-time":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-Y":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--speed-limit":       {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-w":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--write-out":         {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-D":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--dump-header":       {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-c":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--cookie-jar":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--stderr":            {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--output-dir":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--cacert":            {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--capath":            {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-E":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--cert":              {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--cert-type":         {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--key":               {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--key-type":          {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--ciphers":           {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--noproxy":           {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"-U":                  {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--proxy-user":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--dns-servers":       {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--local-port":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--max-filesize":      {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--expect100-timeout": {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--etag-save":         {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--proxy-cacert":      {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--pinnedpubkey":      {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--crlfile":           {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--tls-max":           {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--netrc-file":        {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--rate":              {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--parallel-max":      {hasArg: true, handle: (*Uncurl).flagIgnored},
+	"--create-file-mode":  {hasArg: true, handle: (*Uncurl).flagIgnored},
+}
+
+// parse walks the tokens of a curl string, applying each flag and collecting the target URL. The
+// target is the first token that is neither a flag nor a flag's argument, wherever it appears.
+func (un *Uncurl) parse(b []byte) error {
+	un.format = detectShell(b)
+	toks, err := tokenizeFormat(un.format, b, un.opts.env)
+	if err != nil {
+		return err
+	}
+	if len(toks) == 0 || !isCurlCommand(toks[0].val) {
+		return fmt.Errorf("Failed to find curl command in curl string %s", b)
+	}
+	for _, tok := range toks {
+		un.multiline = un.multiline || tok.cont
+		un.tokenKinds = append(un.tokenKinds, tok.kind)
+	}
+	if err := un.walk(toks[1:], b); err != nil {
+		return err
+	}
+	if un.jsonBody {
+		un.defaultHeader("Content-Type", "application/json")
+		un.defaultHeader("Accept", "application/json")
+	}
+	for _, d := range un.defaults {
+		un.defaultHeader(d.name, d.value)
+	}
+	un.detectBrowser()
+	return nil
+}
+
+// walk applies the flags and positional arguments in toks, which were read from b
+func (un *Uncurl) walk(toks []token, b []byte) error {
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i].val
+		if toks[i].optionValue {
+			un.warn("Ignoring value %s of an option that takes none", tok)
+			continue
+		}
+		if !isFlag(tok) {
+			un.argKind = toks[i].kind
+			if err := un.flagURL("", tok); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(tok, "--") && len(tok) > 2 {
+			n, err := un.walkShort(toks, i, b)
+			if err != nil {
+				return err
+			}
+			i = n
+			continue
+		}
+		spec, known := curlFlags[tok]
+		if !known {
+			if i+1 < len(toks) && !toks[i+1].optionValue && !isFlag(toks[i+1].val) && !looksLikeURL(toks[i+1].val) {
+				// most likely the flag's argument, which must not be taken as the target
+				if un.opts.strict {
+					return fmt.Errorf("Unrecognized flag %s before %s, which is not a URL %s", tok, toks[i+1].val, position(b, toks[i].offset))
+				}
+				i++
+				un.warn("Ignoring unrecognized flag %s and its argument %s", tok, toks[i].val)
+				continue
+			}
+			un.warn("Ignoring unrecognized flag %s", tok)
+			continue
+		}
+		arg := ""
+		if spec.hasArg {
+			if i+1 == len(toks) {
+				return fmt.Errorf("Missing argument for flag %s %s", tok, position(b, toks[i].offset))
+			}
+			i++
+			arg = toks[i].val
+		}
+		if err := un.apply(spec, tok, arg, toks[i].kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isFlag reports whether tok is read as a flag rather than a positional argument
+func isFlag(tok string) bool {
+	return len(tok) >= 2 && tok[0] == '-'
+}
+
+// looksLikeURL reports whether s could be a target URL: one with a scheme, or a bare host name or
+// address, as curl accepts, with an optional port and path
+func looksLikeURL(s string) bool {
+	if strings.Contains(s, "://") {
+		return true
+	}
+	u, err := url.Parse("http://" + s)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	return strings.HasPrefix(u.Host, "[") || strings.Trim(u.Hostname(), "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-_") == ""
+}
+
+// walkShort applies the short flags combined in toks[i], such as -sSL for -s -S -L. A flag that takes
+// an argument ends the group, taking the rest of the token as its value (-XPUT) or, if nothing is
+// left, the next token (-so file). It returns the index of the last token used.
+func (un *Uncurl) walkShort(toks []token, i int, b []byte) (int, error) {
+	tok := toks[i].val
+	for j := 1; j < len(tok); j++ {
+		flag := "-" + tok[j:j+1]
+		spec, known := curlFlags[flag]
+		if !known {
+			un.warn("Ignoring unrecognized flag %s", tok)
+			return i, nil
+		}
+		if !spec.hasArg {
+			if err := un.apply(spec, flag, "", TokenBare); err != nil {
+				return i, err
+			}
+			continue
+		}
+		arg := tok[j+1:]
+		if arg == "" {
+			if i+1 == len(toks) {
+				return i, fmt.Errorf("Missing argument for flag %s %s", flag, position(b, toks[i].offset))
+			}
+			i++
+			arg = toks[i].val
+		}
+		return i, un.apply(spec, flag, arg, toks[i].kind)
+	}
+	return i, nil
+}
+
+// apply runs the handler of a flag, if it has one. kind is the quoting of the token arg came from.
+func (un *Uncurl) apply(spec *flagSpec, flag, arg string, kind TokenKind) error {
+	un.argKind = kind
+	if spec.handle == nil {
+		return nil
+	}
+	return spec.handle(un, flag, arg)
+}
+
+// TokenKinds returns how each word of the original curl string, starting with the curl command itself,
+// was quoted
+func (un *Uncurl) TokenKinds() []TokenKind {
+	return append([]TokenKind(nil), un.tokenKinds...)
+}
+
+// isCurlCommand reports whether s names the curl executable, possibly with a path
+func isCurlCommand(s string) bool {
+	base := path.Base(strings.Replace(s, `\`, "/", -1))
+	return base == "curl" || strings.EqualFold(base, "curl.exe")
+}
+
+// flagHeader handles -H. As in curl, `name;` sends the header with an empty value, while `name:` with
+// nothing after it only suppresses a header curl would otherwise add, so it sends nothing. A repeated
+// header adds a value under the casing it was first given with, as http.Header.Add does, except that
+// repeated Accept-Encoding headers are joined into one list.
+func (un *Uncurl) flagHeader(flag, arg string) error {
+	i := strings.IndexByte(arg, ':')
+	if i < 0 && strings.HasSuffix(arg, ";") {
+		if name := strings.TrimSpace(strings.TrimSuffix(arg, ";")); name != "" {
+			un.recordOrder(headerOrderKey(name))
+			un.addHeader(un.headerName(name), "")
+			return nil
+		}
+	}
+	if i < 1 {
+		un.warn("Ignoring malformed header %q", arg)
+		return nil
+	}
+	name := strings.TrimSpace(arg[:i])
+	value := strings.TrimLeft(arg[i+1:], " \t")
+	if value == "" {
+		return nil
+	}
+	un.recordOrder(headerOrderKey(name))
+	if curlAcceptEncodingRe.MatchString(name) { // use default Transport
+		if un.AcceptEncoding != "" {
+			value = un.AcceptEncoding + ", " + value
+			un.delHeader(name)
+		}
+		un.AcceptEncoding = value
+		if !un.opts.acceptEncodingInHeader() {
+			return nil
+		}
+	}
+	un.addHeader(un.headerName(name), value)
+	return nil
+}
+
+// headerName returns the key a captured header is stored under: as written in the curl string, or
+// lowercased under WithLowercaseHeaders
+func (un *Uncurl) headerName(name string) string {
+	if un.opts.lowercaseHeaders {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// flagMethod handles -X. The method takes precedence over the GET or POST implied by the data flags.
+// As in curl, it is sent as written, since methods are case-sensitive: -X put sends put, not PUT.
+func (un *Uncurl) flagMethod(flag, arg string) error {
+	un.recordOrder("method")
+	un.method = arg
+	return nil
+}
+
+// flagData handles the data flags. Like curl, several data flags are joined with `&`. The plain --data
+// flag and its synonyms -d and --data-ascii have carriage returns and newlines stripped from their
+// value, while --data-raw, --data-binary and --json are kept verbatim. The unstripped values are kept for
+// RawData.
+func (un *Uncurl) flagData(flag, arg string) error {
+	un.recordOrder("data")
+	raw := arg
+	if flag != "--data-raw" && flag != "--data-binary" && flag != "--json" {
+		arg = strings.NewReplacer("\r", "", "\n", "").Replace(arg)
+	}
+	if un.body == nil {
+		un.dataFlag = flag
+		un.body = []byte(arg)
+		un.rawData = []byte(raw)
+		return nil
+	}
+	un.body = append(append(un.body, '&'), arg...)
+	un.rawData = append(append(un.rawData, '&'), raw...)
+	return nil
+}
+
+// flagDataURLEncode handles --data-urlencode, which posts its argument URL-encoded as curl does: all of
+// it, or what follows the first `=`, keeping a name before it. Without an `=`, the name@file and @file
+// forms read a file, which is not done; they are skipped with a warning. The encoded value is kept
+// verbatim, as with --data-raw, so re-emitted commands send the same body.
+func (un *Uncurl) flagDataURLEncode(flag, arg string) error {
+	name, content := "", arg
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		name, content = arg[:i], arg[i+1:]
+	} else if strings.Contains(arg, "@") {
+		un.warn("Not reading file for %s %s", flag, arg)
+		return nil
+	}
+	content = strings.Replace(url.QueryEscape(content), "+", "%20", -1)
+	if name != "" {
+		content = name + "=" + content
+	}
+	return un.flagData("--data-raw", content)
+}
+
+// flagJSON handles --json, which posts its argument like --data-binary and, as in curl, sends JSON
+// Content-Type and Accept headers unless the command sets its own
+func (un *Uncurl) flagJSON(flag, arg string) error {
+	un.jsonBody = true
+	return un.flagData(flag, arg)
+}
+
+// headerDefault is a header a flag sends unless the command gives it with -H
+type headerDefault struct {
+	name, value string
+}
+
+// deferHeader sets the header name a flag sends, once all flags are read, unless a -H gives it. A later
+// flag for the same header replaces an earlier one.
+func (un *Uncurl) deferHeader(name, value string) {
+	un.recordOrder(headerOrderKey(name))
+	for i, d := range un.defaults {
+		if strings.EqualFold(d.name, name) {
+			un.defaults[i].value = value
+			return
+		}
+	}
+	un.defaults = append(un.defaults, headerDefault{name, value})
+}
+
+// defaultHeader adds the header name with value unless one was captured
+func (un *Uncurl) defaultHeader(name, value string) {
+	if un.headerValues(name) == nil {
+		un.header[un.headerName(name)] = []string{value}
+	}
+}
+
+// flagURL handles --url and positional arguments. Only the first URL is used: each further one is
+// ignored with a warning, or is an error under WithStrict.
+func (un *Uncurl) flagURL(flag, arg string) error {
+	if un.target == "" {
+		un.recordOrder("url")
+		un.target = arg
+		return nil
+	}
+	if un.opts.strict {
+		return fmt.Errorf("Found a second URL %s after target %s", arg, un.target)
+	}
+	un.warn("Ignoring extra URL %s", arg)
+	return nil
+}
+
+// flagRange handles -r, sending a `Range: bytes=` header for its ranges, such as 0-1023, 1024- or -500.
+// As in curl, a Range header given with -H takes precedence.
+func (un *Uncurl) flagRange(flag, arg string) error {
+	if arg == "" || strings.Trim(arg, "0123456789-,") != "" || !strings.Contains(arg, "-") {
+		return fmt.Errorf("Invalid %s argument %q, expected a byte range such as 0-1023", flag, arg)
+	}
+	un.deferHeader("Range", "bytes="+arg)
+	return nil
+}
+
+// flagUserAgent handles -A, sending its argument as the User-Agent header unless one is given with -H
+func (un *Uncurl) flagUserAgent(flag, arg string) error {
+	un.deferHeader("User-Agent", arg)
+	return nil
+}
+
+// flagReferer handles -e, sending its argument as the Referer header unless one is given with -H. A
+// trailing `;auto`, which has curl update the Referer on redirects, is dropped.
+func (un *Uncurl) flagReferer(flag, arg string) error {
+	if arg = strings.TrimSuffix(arg, ";auto"); arg != "" && arg != "auto" {
+		un.deferHeader("Referer", arg)
+	}
+	return nil
+}
+
+// flagProxy handles the proxy flags, whose URLs are recorded for ReferencedURLs but not used to send
+// requests
+func (un *Uncurl) flagProxy(flag, arg string) error {
+	un.recordOrder("proxy")
+	if flag == "--proxy" {
+		flag = "-x"
+	}
+	un.proxies = append(un.proxies, proxyFlag{flag, arg})
+	return nil
+}
+
+// proxyFlag is a proxy flag, -x or --preproxy, with its URL
+type proxyFlag struct {
+	flag, url string
+}
+
+// flagInsecure handles -k, which does not change the request but is recorded for IgnoredFlags and so
+// Curl can re-emit it
+func (un *Uncurl) flagInsecure(flag, arg string) error {
+	un.recordOrder("insecure")
+	un.insecure = true
+	return un.flagIgnored(flag, arg)
+}
+
+// flagCompressed handles --compressed, asking for a compressed response and decoding it
+func (un *Uncurl) flagCompressed(flag, arg string) error {
+	un.recordOrder("compressed")
+	un.compressed = true
+	return nil
+}
+
+// flagInclude handles -i, which has curl print the response headers with the body
+func (un *Uncurl) flagInclude(flag, arg string) error {
+	un.recordOrder("include")
+	un.includeHeaders = true
+	return nil
+}
+
+// flagIgnored handles flags that are accepted but do not change the request, recording them for
+// IgnoredFlags
+func (un *Uncurl) flagIgnored(flag, arg string) error {
+	un.ignored = append(un.ignored, flag)
+	return nil
+}
+
+// flagUnsupported handles flags that change the request in a way that is not reproduced, such as the
+// multipart body of -F, consuming their argument so it is not taken as the URL and recording a warning
+func (un *Uncurl) flagUnsupported(flag, arg string) error {
+	un.warn("Ignoring unsupported flag %s", flag)
+	return nil
+}
+
+// IgnoredFlags returns the recognized flags, in the order given, that were parsed but have no effect
+// on the request, such as -s, -v and -k
+func (un *Uncurl) IgnoredFlags() []string {
+	f := make([]string, len(un.ignored))
+	copy(f, un.ignored)
+	return f
+}
@@ -0,0 +1,126 @@
+package uncurl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Format identifies the shell syntax and browser a curl string was interpreted as coming from
+type Format int
+
+const (
+	// FormatUnknown is reported when the Uncurl was not parsed from a curl string
+	FormatUnknown Format = iota
+
+	// FormatChromeBash is POSIX shell quoting, as produced by Chrome's "Copy as cURL (bash)". It is
+	// also used for hand-written commands.
+	FormatChromeBash
+
+	// FormatFirefox is POSIX shell quoting as produced by Firefox's "Copy as cURL (POSIX)"
+	FormatFirefox
+
+	// FormatCmd is Windows cmd.exe quoting, as produced by Chrome's "Copy as cURL (cmd)", with `^`
+	// escapes and line continuations
+	FormatCmd
+
+	// FormatPowerShell is PowerShell quoting, with backtick escapes and line continuations and doubled
+	// single quotes
+	FormatPowerShell
+)
+
+var formatNames = map[Format]string{
+	FormatUnknown:    "Unknown",
+	FormatChromeBash: "ChromeBash",
+	FormatFirefox:    "Firefox",
+	FormatCmd:        "Cmd",
+	FormatPowerShell: "PowerShell",
+}
+
+// String returns the name of the format, e.g. "ChromeBash"
+func (f Format) String() string {
+	if s, ok := formatNames[f]; ok {
+		return s
+	}
+	return "Unknown"
+}
+
+const (
+	// a caret before a quote or at the end of a line only appears in cmd.exe quoting
+	curlCmdPattern = `\^"|\^\r?\n`
+
+	// a backtick at the end of a line, or a leading curl.exe, indicates PowerShell
+	curlPowerShellPattern = "`\\r?\\n|^\\s*curl\\.exe\\s"
+)
+
+var curlCmdRe, curlPowerShellRe *regexp.Regexp
+
+func init() {
+	curlCmdRe = regexp.MustCompile(curlCmdPattern)
+	curlPowerShellRe = regexp.MustCompile(curlPowerShellPattern)
+}
+
+// detectShell picks the shell syntax to tokenize b with. The cmd.exe and PowerShell markers are only
+// looked for outside POSIX quotes, so a bash argument holding `^"` or a backtick stays bash. Browser
+// detection happens after parsing, in detectBrowser.
+func detectShell(b []byte) Format {
+	unquoted := maskPOSIXQuoted(b)
+	switch {
+	case curlCmdRe.Match(unquoted):
+		return FormatCmd
+	case curlPowerShellRe.Match(unquoted):
+		return FormatPowerShell
+	}
+	return FormatChromeBash
+}
+
+// maskPOSIXQuoted returns a copy of b with the contents of its POSIX single-quoted, double-quoted and
+// ANSI-C quoted strings replaced by spaces, keeping the quotes themselves and everything outside them
+func maskPOSIXQuoted(b []byte) []byte {
+	m := make([]byte, len(b))
+	copy(m, b)
+	var quote byte // the quote of the string being masked, or 0 outside quotes
+	ansiC := false
+	for i := 0; i < len(m); i++ {
+		c := m[i]
+		switch {
+		case quote == 0 && c == '\\':
+			i++ // an escaped character opens no quote
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+			ansiC = c == '\'' && i > 0 && b[i-1] == '$'
+		case quote == 0:
+		case c == quote:
+			quote = 0
+		case c == '\\' && (quote == '"' || ansiC) && i+1 < len(m):
+			m[i], m[i+1] = ' ', ' '
+			i++
+		default:
+			m[i] = ' '
+		}
+	}
+	return m
+}
+
+// detectBrowser refines a POSIX format to FormatFirefox when the captured User-Agent is Firefox's
+func (un *Uncurl) detectBrowser() {
+	if un.format == FormatChromeBash && strings.Contains(un.headerGet("User-Agent"), "Firefox/") {
+		un.format = FormatFirefox
+	}
+}
+
+// Format returns the format the curl string was interpreted as
+func (un *Uncurl) Format() Format {
+	return un.format
+}
+
+// tokenizeFormat splits b into words using the quoting rules of format f. env is used for variable
+// expansion in POSIX input.
+func tokenizeFormat(f Format, b []byte, env map[string]string) ([]token, error) {
+	switch f {
+	case FormatCmd:
+		return tokenizeCmd(b)
+	case FormatPowerShell:
+		return tokenizePowerShell(b)
+	}
+	return tokenize(b, env)
+}
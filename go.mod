@@ -1,3 +1,5 @@
 module github.com/jrefior/uncurl
 
 go 1.13
+
+require github.com/andybalholm/brotli v1.1.1
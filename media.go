@@ -0,0 +1,78 @@
+package uncurl
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaType is one media range of an Accept header
+type MediaType struct {
+	// Type is the lowercased media range, such as "text/html", "image/*" or "*/*"
+	Type string
+
+	// Params holds the media type parameters other than q, such as v=b3
+	Params map[string]string
+
+	// Q is the quality value, 1 if none was given
+	Q float64
+}
+
+// specificity ranks a media range: 0 for */*, 1 for type/* and 2 for a full type, plus the number of
+// parameters
+func (m MediaType) specificity() int {
+	n := len(m.Params)
+	switch {
+	case m.Type == "*/*":
+	case strings.HasSuffix(m.Type, "/*"):
+		n++
+	default:
+		n += 2
+	}
+	return n
+}
+
+// AcceptTypes parses the Accept header into its media ranges, sorted by preference: highest q-value
+// first, then more specific ranges before less specific ones, as RFC 7231 has them take precedence,
+// then in the order written. Malformed ranges are skipped.
+func (un *Uncurl) AcceptTypes() []MediaType {
+	var types []MediaType
+	for _, v := range un.headerValues("Accept") {
+		for _, r := range strings.Split(v, ",") {
+			if strings.TrimSpace(r) == "" {
+				continue
+			}
+			mt, params, err := mime.ParseMediaType(r)
+			if err != nil {
+				continue
+			}
+			m := MediaType{Type: mt, Params: params, Q: 1}
+			if q, ok := params["q"]; ok {
+				if m.Q, err = strconv.ParseFloat(q, 64); err != nil || m.Q < 0 || m.Q > 1 {
+					continue
+				}
+				delete(params, "q")
+			}
+			types = append(types, m)
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].Q != types[j].Q {
+			return types[i].Q > types[j].Q
+		}
+		return types[i].specificity() > types[j].specificity()
+	})
+	return types
+}
+
+// IsSSE reports whether the Accept header asks for text/event-stream, marking a Server-Sent Events
+// endpoint whose response should be read as a stream rather than buffered
+func (un *Uncurl) IsSSE() bool {
+	for _, m := range un.AcceptTypes() {
+		if m.Type == "text/event-stream" && m.Q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package uncurl
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mockKeyHeaders are the captured headers a MockHandler requires incoming requests to match
+var mockKeyHeaders = []string{"Authorization", "Content-Type"}
+
+// MockHandler returns a handler for contract tests that accepts requests shaped like the uncurled one:
+// the same method and path, and the same Authorization and Content-Type headers where those were
+// captured. Matching requests are answered with status and respBody; anything else gets a 400 Bad
+// Request response describing the mismatch.
+func (un *Uncurl) MockHandler(status int, respBody []byte) http.Handler {
+	var path string
+	if u, err := url.Parse(un.target); err == nil {
+		path = u.EscapedPath()
+	}
+	want := make(map[string]string)
+	for _, k := range mockKeyHeaders {
+		if v := un.headerGet(k); v != "" {
+			want[k] = v
+		}
+	}
+	method := un.method
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var problems []string
+		if r.Method != method {
+			problems = append(problems, fmt.Sprintf("method %s, expected %s", r.Method, method))
+		}
+		if p := r.URL.EscapedPath(); p != path {
+			problems = append(problems, fmt.Sprintf("path %s, expected %s", p, path))
+		}
+		for _, k := range mockKeyHeaders {
+			if v, ok := want[k]; ok && r.Header.Get(k) != v {
+				problems = append(problems, fmt.Sprintf("header %s %q, expected %q", k, r.Header.Get(k), v))
+			}
+		}
+		if problems != nil {
+			http.Error(w, "Request does not match capture: "+strings.Join(problems, "; "), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(respBody)
+	})
+}
@@ -0,0 +1,123 @@
+package uncurl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// openAPIOperation and the types below mirror the subset of the OpenAPI 3 schema needed to describe a
+// single operation
+type openAPIOperation struct {
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name    string                 `json:"name"`
+	In      string                 `json:"in"`
+	Schema  map[string]interface{} `json:"schema"`
+	Example string                 `json:"example,omitempty"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// OpenAPIOperation renders a minimal OpenAPI 3 path item in JSON for the request, mapping the target's
+// path to an operation under the lowercased method. Query parameters become string parameters, in the
+// order they first appear, with their captured value as the example. A JSON body gets a request body
+// schema inferred from its value; any other body is described by its Content-Type alone.
+func (un *Uncurl) OpenAPIOperation() ([]byte, error) {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return nil, fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	}
+	op := openAPIOperation{
+		Responses: map[string]openAPIResponse{"default": {Description: "Captured response"}},
+	}
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		name, _ := url.QueryUnescape(kv[0])
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		p := openAPIParameter{Name: name, In: "query", Schema: map[string]interface{}{"type": "string"}}
+		if len(kv) == 2 {
+			p.Example, _ = url.QueryUnescape(kv[1])
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+	if un.body != nil {
+		mediaType, _, _ := mime.ParseMediaType(un.headerGet("Content-Type"))
+		schema := map[string]interface{}{}
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(un.body))
+		d.UseNumber()
+		if d.Decode(&v) == nil {
+			schema = inferSchema(v)
+			if mediaType == "" {
+				mediaType = "application/json"
+			}
+		}
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		op.RequestBody = &openAPIRequestBody{
+			Content: map[string]openAPIMediaType{mediaType: {Schema: schema}},
+		}
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return json.Marshal(map[string]map[string]openAPIOperation{
+		path: {strings.ToLower(un.method): op},
+	})
+}
+
+// inferSchema returns a JSON Schema describing v, a value decoded with json.Decoder.UseNumber. The
+// items of an array are described by its first element.
+func inferSchema(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			props[k] = inferSchema(e)
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	case []interface{}:
+		items := map[string]interface{}{}
+		if len(v) > 0 {
+			items = inferSchema(v[0])
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return map[string]interface{}{"type": "integer"}
+		}
+		return map[string]interface{}{"type": "number"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{"nullable": true}
+}
@@ -0,0 +1,160 @@
+package uncurl
+
+import (
+	"io"
+	"time"
+)
+
+// Option adjusts how New parses a curl string and how requests are generated from the result
+type Option func(*options)
+
+// options collects the settings applied by Option values
+type options struct {
+	chunkedBody        bool
+	keepAcceptEncoding bool
+	acceptEncodingHdr  bool
+	baseURL            string
+	lowercaseHeaders   bool
+	env                map[string]string
+	maxCommands        int
+	schemes            []string
+	fileReads          bool
+	stdin              io.Reader
+	keepAuthority      bool
+	strict             bool
+	timeout            time.Duration
+	urlSpaceEncoding   bool
+}
+
+// WithChunkedBody makes Request() send the body with chunked transfer encoding even though its length
+// is known, by leaving ContentLength at -1
+func WithChunkedBody() Option {
+	return func(o *options) {
+		o.chunkedBody = true
+	}
+}
+
+// WithKeepAcceptEncoding leaves the captured Accept-Encoding header in the header map, so Header() and
+// Request() carry it exactly as curl would send it. AcceptEncoding is still populated. Note that this
+// disables the transparent gzip decoding of net/http's default Transport.
+func WithKeepAcceptEncoding() Option {
+	return func(o *options) {
+		o.keepAcceptEncoding = true
+	}
+}
+
+// WithBaseURL resolves a relative target, such as a bare path, against base. Absolute targets are left
+// unchanged.
+func WithBaseURL(base string) Option {
+	return func(o *options) {
+		o.baseURL = base
+	}
+}
+
+// WithLowercaseHeaders stores every captured header key in lowercase, as Chrome shows them for HTTP/2.
+// Keys are never canonicalized by uncurl, and net/http writes HTTP/1.1 header keys as they appear in
+// the map, so the lowercase keys reach the wire unchanged.
+func WithLowercaseHeaders() Option {
+	return func(o *options) {
+		o.lowercaseHeaders = true
+	}
+}
+
+// WithAcceptEncodingInHeader places the captured Accept-Encoding in the header map as well as in the
+// AcceptEncoding field, so Header() includes it. Unlike WithKeepAcceptEncoding it is not put on
+// generated requests, which keep net/http's transparent gzip; the two options may be combined.
+func WithAcceptEncodingInHeader() Option {
+	return func(o *options) {
+		o.acceptEncodingHdr = true
+	}
+}
+
+// acceptEncodingInHeader reports whether a captured Accept-Encoding belongs in the header map
+func (o *options) acceptEncodingInHeader() bool {
+	return o.keepAcceptEncoding || o.acceptEncodingHdr
+}
+
+// WithEnvExpansion expands `$NAME` and `${NAME}` references in bare and double-quoted words of a POSIX
+// curl string, using the values in env. References to variables not in env are left as written, as
+// they are by default.
+func WithEnvExpansion(env map[string]string) Option {
+	return func(o *options) {
+		o.env = env
+	}
+}
+
+// WithMaxCommands makes NewUncurlAll fail if its input holds more than n commands, bounding the work
+// done for untrusted input. A value of 0 or less means no limit.
+func WithMaxCommands(n int) Option {
+	return func(o *options) {
+		o.maxCommands = n
+	}
+}
+
+// WithAllowedSchemes makes New (and SetTarget) fail for targets whose scheme is not one of schemes,
+// compared case-insensitively, e.g. WithAllowedSchemes("http", "https") to refuse file:// or ftp://
+// targets. By default any scheme url.ParseRequestURI accepts is allowed.
+func WithAllowedSchemes(schemes ...string) Option {
+	return func(o *options) {
+		o.schemes = append([]string{}, schemes...)
+	}
+}
+
+// WithFileReads lets flags that name a local file, such as -K/--config, read it. By default the flag
+// and its argument are consumed without reading the file, with a warning recorded. Reads are opt-in
+// rather than opt-out because curl strings are often pasted from untrusted sources: a command naming
+// a file such as ~/.netrc or /etc/passwd would otherwise have it read and merged into a request bound
+// for any host the command chooses.
+func WithFileReads() Option {
+	return func(o *options) {
+		o.fileReads = true
+	}
+}
+
+// WithoutFileReads stops flags that name a local file from reading it, undoing an earlier
+// WithFileReads. It is the default.
+func WithoutFileReads() Option {
+	return func(o *options) {
+		o.fileReads = false
+	}
+}
+
+// WithStdin supplies the input read by flags whose argument is `@-`, such as -b @-, which curl reads
+// from its standard input. Without it such flags fail to parse.
+func WithStdin(r io.Reader) Option {
+	return func(o *options) {
+		o.stdin = r
+	}
+}
+
+// WithKeepAuthorityHeader sends a captured authority header as an ordinary header on generated
+// requests, for custom transports that want it verbatim, instead of using it as the request Host
+func WithKeepAuthorityHeader() Option {
+	return func(o *options) {
+		o.keepAuthority = true
+	}
+}
+
+// WithStrict makes New fail on input it would otherwise accept with a warning, such as a curl string
+// holding two URLs or a Content-Length header that does not match the body
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithTimeout sets the Timeout of the client Do builds when it is given a nil client. A --max-time in
+// the curl string takes precedence.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithURLSpaceEncoding percent-encodes literal spaces in the target as %20, for messy captures such as
+// curl 'https://host/a b'. It applies to SetTarget as well. Without it the target is kept as written.
+func WithURLSpaceEncoding() Option {
+	return func(o *options) {
+		o.urlSpaceEncoding = true
+	}
+}
@@ -0,0 +1,94 @@
+package uncurl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// postmanItem and the types below mirror the subset of the Postman v2.1 collection schema needed to
+// describe a single request
+type postmanItem struct {
+	Name    string         `json:"name"`
+	Request postmanRequest `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string       `json:"method"`
+	Header []postmanKV  `json:"header"`
+	Body   *postmanBody `json:"body,omitempty"`
+	URL    postmanURL   `json:"url"`
+}
+
+type postmanKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+type postmanURL struct {
+	Raw      string      `json:"raw"`
+	Protocol string      `json:"protocol,omitempty"`
+	Host     []string    `json:"host,omitempty"`
+	Port     string      `json:"port,omitempty"`
+	Path     []string    `json:"path,omitempty"`
+	Query    []postmanKV `json:"query,omitempty"`
+}
+
+// PostmanItem renders the request as a single Postman v2.1 collection item in JSON, suitable for
+// pasting into the "item" array of a collection. Headers are emitted in sorted order, with a captured
+// authority header as the Host and the -b cookies in the Cookie header; as with Header(),
+// Accept-Encoding is not included.
+func (un *Uncurl) PostmanItem() ([]byte, error) {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return nil, fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	}
+	pu := postmanURL{
+		Raw:      un.target,
+		Protocol: u.Scheme,
+		Port:     u.Port(),
+	}
+	if h := u.Hostname(); h != "" {
+		pu.Host = strings.Split(h, ".")
+	}
+	if p := strings.TrimPrefix(u.EscapedPath(), "/"); p != "" {
+		pu.Path = strings.Split(p, "/")
+	}
+	if u.RawQuery != "" {
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			kv := strings.SplitN(pair, "=", 2)
+			q := postmanKV{Key: kv[0]}
+			if len(kv) == 2 {
+				q.Value = kv[1]
+			}
+			pu.Query = append(pu.Query, q)
+		}
+	}
+	item := postmanItem{
+		Name: un.target,
+		Request: postmanRequest{
+			Method: un.method,
+			Header: []postmanKV{},
+			URL:    pu,
+		},
+	}
+	h := un.headerWithCookies()
+	if host := un.authorityHost(h); host != "" && un.headerValues("Host") == nil {
+		h["Host"] = []string{host}
+	}
+	for _, k := range sortedKeys(h) {
+		for _, v := range h[k] {
+			item.Request.Header = append(item.Request.Header, postmanKV{Key: k, Value: v})
+		}
+	}
+	if un.body != nil {
+		item.Request.Body = &postmanBody{Mode: "raw", Raw: string(un.body)}
+	}
+	return json.Marshal(item)
+}
@@ -0,0 +1,111 @@
+package uncurl
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// filterQuery rewrites the target's query, keeping only the parameters for which keep returns true.
+// Remaining parameters keep their original order and encoding.
+func (un *Uncurl) filterQuery(keep func(name string) bool) error {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	}
+	if u.RawQuery == "" {
+		return nil
+	}
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			name = pair[:i]
+		}
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if keep(name) {
+			kept = append(kept, pair)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	un.target = u.String()
+	return nil
+}
+
+// DropQueryParams removes every query parameter with one of the given names from the target URL
+func (un *Uncurl) DropQueryParams(names ...string) error {
+	drop := make(map[string]bool, len(names))
+	for _, n := range names {
+		drop[n] = true
+	}
+	return un.filterQuery(func(name string) bool {
+		return !drop[name]
+	})
+}
+
+// trackingParams are the analytics query parameters StripTrackingParams removes by exact name, in
+// addition to any starting with utm_
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+}
+
+// StripTrackingParams removes common analytics parameters from the target URL: utm_* campaign tags,
+// ad click identifiers such as gclid and fbclid, and Google Analytics linker parameters such as _ga
+func (un *Uncurl) StripTrackingParams() error {
+	return un.filterQuery(func(name string) bool {
+		return !strings.HasPrefix(strings.ToLower(name), "utm_") && !trackingParams[strings.ToLower(name)]
+	})
+}
+
+// SortQuery re-encodes the target's query with its parameters sorted by name, and by value for
+// repeated names, so equivalent captures produce the same URL for hashing and dedup. Parameters are
+// re-escaped in the form url.Values uses, so the original encoding is not kept, except for those that
+// fail to unescape or hold a `;`, which some servers treat as a separator: they are kept as written,
+// sorted by their raw text.
+func (un *Uncurl) SortQuery() {
+	u, err := url.Parse(un.target)
+	if err != nil || u.RawQuery == "" {
+		return
+	}
+	type param struct{ name, value, text string }
+	var params []param
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		name, nerr := url.QueryUnescape(kv[0])
+		value, verr := url.QueryUnescape(kv[1])
+		if nerr != nil || verr != nil || strings.Contains(pair, ";") {
+			params = append(params, param{kv[0], kv[1], pair})
+			continue
+		}
+		params = append(params, param{name, value, url.QueryEscape(name) + "=" + url.QueryEscape(value)})
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].value < params[j].value
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.text
+	}
+	u.RawQuery = strings.Join(pairs, "&")
+	u.ForceQuery = false
+	un.target = u.String()
+}
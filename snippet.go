@@ -0,0 +1,172 @@
+package uncurl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fetchIgnoredHeaders lists the headers DevTools leaves out of "Copy as fetch", as the browser sets them
+// itself or forbids scripts from setting them
+var fetchIgnoredHeaders = map[string]bool{
+	"accept-charset":                 true,
+	"accept-encoding":                true,
+	"access-control-request-headers": true,
+	"access-control-request-method":  true,
+	"connection":                     true,
+	"content-length":                 true,
+	"cookie":                         true,
+	"cookie2":                        true,
+	"date":                           true,
+	"dnt":                            true,
+	"expect":                         true,
+	"host":                           true,
+	"keep-alive":                     true,
+	"origin":                         true,
+	"referer":                        true,
+	"te":                             true,
+	"trailer":                        true,
+	"transfer-encoding":              true,
+	"upgrade":                        true,
+	"via":                            true,
+	"user-agent":                     true,
+	"authority":                      true,
+}
+
+// fetchIgnoredSec reports whether the lowercased header lk is one of the forbidden sec- headers DevTools
+// leaves out of "Copy as fetch". The sec-ch-ua client hints and sec-fetch- metadata are kept, as
+// DevTools keeps them.
+func fetchIgnoredSec(lk string) bool {
+	return strings.HasPrefix(lk, "sec-") && !strings.HasPrefix(lk, "sec-ch-ua") && !strings.HasPrefix(lk, "sec-fetch-")
+}
+
+// Fetch renders the request as a JavaScript fetch() call in the layout of DevTools' "Copy as fetch".
+// Headers the browser manages are left out, with the Referer becoming the referrer option. A kept
+// Accept-Encoding header (see WithKeepAcceptEncoding) is included unless --compressed was given, in
+// which case the browser's own negotiation is relied on.
+func (un *Uncurl) Fetch() string {
+	var headers []string
+	for k, v := range un.header {
+		lk := strings.ToLower(k)
+		if lk == "accept-encoding" {
+			if un.compressed {
+				continue
+			}
+		} else if fetchIgnoredHeaders[lk] || fetchIgnoredSec(lk) || strings.HasPrefix(lk, "proxy-") || strings.HasPrefix(lk, ":") {
+			continue
+		}
+		headers = append(headers, fmt.Sprintf("    %s: %s", jsString(lk), jsString(strings.Join(v, ", "))))
+	}
+	sort.Strings(headers)
+	var b strings.Builder
+	fmt.Fprintf(&b, "fetch(%s, {\n", jsString(un.target))
+	if len(headers) == 0 {
+		b.WriteString("  \"headers\": {},\n")
+	} else {
+		fmt.Fprintf(&b, "  \"headers\": {\n%s\n  },\n", strings.Join(headers, ",\n"))
+	}
+	if ref := un.headerGet("Referer"); ref != "" {
+		fmt.Fprintf(&b, "  \"referrer\": %s,\n", jsString(ref))
+	}
+	if un.body != nil {
+		fmt.Fprintf(&b, "  \"body\": %s,\n", jsString(string(un.body)))
+	} else {
+		b.WriteString("  \"body\": null,\n")
+	}
+	fmt.Fprintf(&b, "  \"method\": %s,\n", jsString(un.method))
+	b.WriteString("  \"mode\": \"cors\",\n")
+	credentials := "omit"
+	if un.headerValues("Cookie") != nil || un.cookies != nil || un.headerValues("Authorization") != nil {
+		credentials = "include"
+	}
+	fmt.Fprintf(&b, "  \"credentials\": %s\n});", jsString(credentials))
+	return b.String()
+}
+
+// jsString quotes s as a JSON (and so JavaScript) string literal without HTML escaping
+func jsString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// K6Script renders the request as a k6 load test script making one http.request() call with the
+// captured method, URL, body and headers. A captured authority header becomes the Host header, the -b
+// cookies join the Cookie header, and repeated values are joined into one, with `; ` for cookies. As
+// with Header(), Accept-Encoding is left to k6, which negotiates and decodes compression itself.
+func (un *Uncurl) K6Script() string {
+	var b strings.Builder
+	b.WriteString("import http from 'k6/http';\n\nexport default function () {\n")
+	body := "null"
+	if un.body != nil {
+		body = jsString(string(un.body))
+	}
+	fmt.Fprintf(&b, "  http.request(%s, %s, %s, {\n", jsString(un.method), jsString(un.target), body)
+	h := un.headerWithCookies()
+	if host := un.authorityHost(h); host != "" && un.headerValues("Host") == nil {
+		h["Host"] = []string{host}
+	}
+	keys := sortedKeys(h)
+	if len(keys) == 0 {
+		b.WriteString("    headers: {},\n")
+	} else {
+		b.WriteString("    headers: {\n")
+		for _, k := range keys {
+			sep := ", "
+			if strings.EqualFold(k, "Cookie") {
+				sep = "; "
+			}
+			fmt.Fprintf(&b, "      %s: %s,\n", jsString(k), jsString(strings.Join(h[k], sep)))
+		}
+		b.WriteString("    },\n")
+	}
+	b.WriteString("  });\n}\n")
+	return b.String()
+}
+
+// GoSnippet renders the request as a Go program building the same *http.Request with net/http alone
+// and sending it with the default client. A captured authority header sets the Host, and the cookies
+// from -b or AddCookie are added with AddCookie, as in Request.
+// As with Header(), Accept-Encoding is left to the Transport, which negotiates and decodes gzip itself.
+func (un *Uncurl) GoSnippet() string {
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"log\"\n\t\"net/http\"\n")
+	body := "nil"
+	if un.body != nil {
+		b.WriteString("\t\"strings\"\n")
+		body = "body"
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+	if un.body != nil {
+		fmt.Fprintf(&b, "\tbody := strings.NewReader(%s)\n", strconv.Quote(string(un.body)))
+	}
+	fmt.Fprintf(&b, "\treq, err := http.NewRequest(%s, %s, %s)\n", strconv.Quote(un.method), strconv.Quote(un.target), body)
+	b.WriteString("\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n")
+	h := make(map[string][]string, len(un.header))
+	for k, v := range un.header {
+		h[k] = v
+	}
+	if host := un.authorityHost(h); host != "" {
+		fmt.Fprintf(&b, "\treq.Host = %s\n", strconv.Quote(host))
+	}
+	for _, k := range sortedKeys(h) {
+		for i, v := range h[k] {
+			method := "Add"
+			if i == 0 {
+				method = "Set"
+			}
+			fmt.Fprintf(&b, "\treq.Header.%s(%s, %s)\n", method, strconv.Quote(k), strconv.Quote(v))
+		}
+	}
+	for _, c := range un.addedCookies() {
+		fmt.Fprintf(&b, "\treq.AddCookie(&http.Cookie{Name: %s, Value: %s})\n", strconv.Quote(c.Name), strconv.Quote(c.Value))
+	}
+	b.WriteString("\tresp, err := http.DefaultClient.Do(req)\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n")
+	b.WriteString("\tdefer resp.Body.Close()\n\tfmt.Println(resp.Status)\n}\n")
+	return b.String()
+}
@@ -0,0 +1,562 @@
+package uncurl
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// token is one shell word of a curl string
+type token struct {
+	// val is the word with quoting and escapes removed
+	val string
+
+	// offset is the byte offset in the input at which the word starts
+	offset int
+
+	// cont is true when a line continuation came before the word or within it
+	cont bool
+
+	// kind is how the word was quoted
+	kind TokenKind
+
+	// optionValue is true for the value of a config file option, which is never a positional argument
+	optionValue bool
+}
+
+// TokenKind records how a word of a curl string was quoted. A word quoted in several ways, such as
+// -H'a: '"$b", has the kind of its first quoted part.
+type TokenKind int
+
+const (
+	// TokenBare is a word without quotes, though it may contain backslash escapes
+	TokenBare TokenKind = iota
+
+	// TokenSingleQuoted is a word in single quotes
+	TokenSingleQuoted
+
+	// TokenDoubleQuoted is a word in double quotes
+	TokenDoubleQuoted
+
+	// TokenANSICQuoted is a word in POSIX ANSI-C `$'...'` quotes
+	TokenANSICQuoted
+)
+
+var tokenKindNames = map[TokenKind]string{
+	TokenBare:         "Bare",
+	TokenSingleQuoted: "SingleQuoted",
+	TokenDoubleQuoted: "DoubleQuoted",
+	TokenANSICQuoted:  "ANSICQuoted",
+}
+
+// String returns the name of the kind, e.g. "SingleQuoted"
+func (k TokenKind) String() string {
+	if s, ok := tokenKindNames[k]; ok {
+		return s
+	}
+	return "Bare"
+}
+
+// tokenize splits a curl string into shell words the way a POSIX shell would, honoring single quotes,
+// double quotes, ANSI-C `$'...'` quotes, backslash escapes and backslash-newline continuations.
+// Outside of single and ANSI-C quotes, `$NAME` and `${NAME}` are replaced by their value in env; any
+// other `$` is kept literally, as there is no environment to expand from.
+func tokenize(b []byte, env map[string]string) ([]token, error) {
+	var toks []token
+	var cur []byte
+	inTok := false
+	start := 0
+	begin := func(i int) {
+		if !inTok {
+			inTok = true
+			start = i
+		}
+	}
+	cont := false
+	kind := TokenBare
+	quoted := func(k TokenKind) {
+		if kind == TokenBare {
+			kind = k
+		}
+	}
+	end := func() {
+		if inTok {
+			toks = append(toks, token{val: string(cur), offset: start, cont: cont, kind: kind})
+			cur = nil
+			inTok, cont, kind = false, false, TokenBare
+		}
+	}
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			end()
+		case c == '\\':
+			if i+1 < len(b) && b[i+1] == '\n' { // line continuation
+				i++
+				cont = true
+				continue
+			}
+			if i+2 < len(b) && b[i+1] == '\r' && b[i+2] == '\n' {
+				i += 2
+				cont = true
+				continue
+			}
+			begin(i)
+			if i+1 < len(b) {
+				i++
+				cur = append(cur, b[i])
+			}
+		case c == '\'':
+			begin(i)
+			quoted(TokenSingleQuoted)
+			j := i + 1
+			for j < len(b) && b[j] != '\'' {
+				j++
+			}
+			if j == len(b) {
+				return nil, fmt.Errorf("Unterminated single quote %s", position(b, i))
+			}
+			cur = append(cur, b[i+1:j]...)
+			i = j
+		case c == '"':
+			begin(i)
+			quoted(TokenDoubleQuoted)
+			j := i + 1
+			for ; j < len(b) && b[j] != '"'; j++ {
+				if b[j] == '\\' && j+1 < len(b) {
+					switch b[j+1] {
+					case '"', '\\', '$', '`':
+						j++
+						cur = append(cur, b[j])
+						continue
+					case '\n':
+						j++
+						continue
+					}
+				}
+				if b[j] == '$' {
+					if val, n := expandVar(b[j:], env); n > 0 {
+						cur = append(cur, val...)
+						j += n - 1
+						continue
+					}
+				}
+				cur = append(cur, b[j])
+			}
+			if j == len(b) {
+				return nil, fmt.Errorf("Unterminated double quote %s", position(b, i))
+			}
+			i = j
+		case c == '$' && i+1 < len(b) && b[i+1] == '\'':
+			begin(i)
+			quoted(TokenANSICQuoted)
+			val, j, ok := decodeANSIC(b, i+2)
+			if !ok {
+				return nil, fmt.Errorf("Unterminated $'...' quote %s", position(b, i))
+			}
+			cur = append(cur, val...)
+			i = j
+		case c == '$':
+			begin(i)
+			val, n := expandVar(b[i:], env)
+			if n == 0 {
+				cur = append(cur, c)
+				continue
+			}
+			cur = append(cur, val...)
+			i += n - 1
+		default:
+			begin(i)
+			cur = append(cur, c)
+		}
+	}
+	end()
+	return toks, nil
+}
+
+// expandVar expands a `$NAME` or `${NAME}` reference at the start of b using env. It returns the value
+// and the length of the reference, or a length of 0 if b does not start with a reference to a variable
+// in env.
+func expandVar(b []byte, env map[string]string) (string, int) {
+	if len(env) == 0 || len(b) < 2 || b[0] != '$' {
+		return "", 0
+	}
+	braced := b[1] == '{'
+	i := 1
+	if braced {
+		i++
+	}
+	j := i
+	for j < len(b) && (b[j] == '_' || (b[j] >= 'a' && b[j] <= 'z') || (b[j] >= 'A' && b[j] <= 'Z') || (j > i && b[j] >= '0' && b[j] <= '9')) {
+		j++
+	}
+	if j == i {
+		return "", 0
+	}
+	name := string(b[i:j])
+	if braced {
+		if j == len(b) || b[j] != '}' {
+			return "", 0
+		}
+		j++
+	}
+	val, ok := env[name]
+	if !ok {
+		return "", 0
+	}
+	return val, j
+}
+
+// decodeANSIC decodes the body of a `$'...'` quote starting at b[i], as emitted by Chrome for values
+// containing newlines or other special characters. It returns the decoded bytes and the index of the
+// closing quote, or false if the quote is never closed.
+func decodeANSIC(b []byte, i int) ([]byte, int, bool) {
+	var out []byte
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c == '\'' {
+			return out, i, true
+		}
+		if c != '\\' || i+1 == len(b) {
+			out = append(out, c)
+			continue
+		}
+		i++
+		switch e := b[i]; e {
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'e', 'E':
+			out = append(out, 0x1b)
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case '\\', '\'', '"', '?':
+			out = append(out, e)
+		case 'x', 'u', 'U':
+			max := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+			j := i + 1
+			for j < len(b) && j-i-1 < max && isHex(b[j]) {
+				j++
+			}
+			if j == i+1 {
+				out = append(out, '\\', e)
+				continue
+			}
+			n, _ := strconv.ParseUint(string(b[i+1:j]), 16, 32)
+			if e == 'x' {
+				out = append(out, byte(n))
+			} else {
+				var buf [utf8.UTFMax]byte
+				out = append(out, buf[:utf8.EncodeRune(buf[:], rune(n))]...)
+			}
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(b) && j-i < 3 && b[j] >= '0' && b[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(string(b[i:j]), 8, 8)
+			out = append(out, byte(n))
+			i = j - 1
+		default:
+			out = append(out, '\\', e)
+		}
+	}
+	return nil, i, false
+}
+
+// position describes byte offset off of b for error messages, e.g. "at offset 42 (line 1, column 43)"
+func position(b []byte, off int) string {
+	line := bytes.Count(b[:off], []byte{'\n'}) + 1
+	col := off - bytes.LastIndexByte(b[:off], '\n')
+	return fmt.Sprintf("at offset %d (line %d, column %d)", off, line, col)
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// tokenizeCmd splits a curl string quoted for Windows cmd.exe into words. It first reproduces cmd.exe,
+// which removes `^` escapes outside of double quotes (a caret before a newline continues the line),
+// then splits the result into arguments as the Microsoft C runtime does: double quotes group
+// characters and backslashes only escape quotes.
+func tokenizeCmd(b []byte) ([]token, error) {
+	var line []byte
+	var offs []int
+	conts := map[int]bool{} // indices in line that follow a continuation
+	quoted := false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '^' && !quoted:
+			i++
+			if i < len(b) && b[i] == '\r' {
+				i++
+			}
+			if i < len(b) && b[i] == '\n' { // continuation; the character after it is taken literally
+				i++
+				conts[len(line)] = true
+			}
+			if i == len(b) {
+				continue
+			}
+			c = b[i]
+		}
+		line = append(line, c)
+		offs = append(offs, i)
+	}
+	var toks []token
+	var cur []byte
+	inTok := false
+	quoted = false
+	start, quoteStart := 0, 0
+	cont := false
+	kind := TokenBare
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		cont = cont || conts[i]
+		if !quoted && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			if inTok {
+				toks = append(toks, token{val: string(cur), offset: offs[start], cont: cont, kind: kind})
+				cur, inTok, cont, kind = nil, false, false, TokenBare
+			}
+			continue
+		}
+		if !inTok {
+			inTok, start = true, i
+		}
+		switch c {
+		case '\\':
+			n := 0
+			for i+n < len(line) && line[i+n] == '\\' {
+				n++
+			}
+			if i+n < len(line) && line[i+n] == '"' {
+				cur = append(cur, bytes.Repeat([]byte{'\\'}, n/2)...)
+				if n%2 == 1 {
+					cur = append(cur, '"')
+					i += n
+					continue
+				}
+				i += n - 1 // the quote is handled on the next pass
+				continue
+			}
+			cur = append(cur, bytes.Repeat([]byte{'\\'}, n)...)
+			i += n - 1
+		case '"':
+			if !quoted {
+				quoteStart = i
+			}
+			quoted = !quoted
+			kind = TokenDoubleQuoted
+		default:
+			cur = append(cur, c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("Unterminated double quote %s", position(b, offs[quoteStart]))
+	}
+	if inTok {
+		toks = append(toks, token{val: string(cur), offset: offs[start], cont: cont, kind: kind})
+	}
+	return toks, nil
+}
+
+// tokenizePowerShell splits a curl string quoted for PowerShell into words. Single quotes are literal
+// except that a doubled quote stands for one; double quotes honor backtick escapes such as `n, and a
+// backtick at the end of a line continues it. Variables are not expanded.
+func tokenizePowerShell(b []byte) ([]token, error) {
+	var toks []token
+	var cur []byte
+	inTok := false
+	start := 0
+	begin := func(i int) {
+		if !inTok {
+			inTok = true
+			start = i
+		}
+	}
+	cont := false
+	kind := TokenBare
+	quoted := func(k TokenKind) {
+		if kind == TokenBare {
+			kind = k
+		}
+	}
+	end := func() {
+		if inTok {
+			toks = append(toks, token{val: string(cur), offset: start, cont: cont, kind: kind})
+			cur = nil
+			inTok, cont, kind = false, false, TokenBare
+		}
+	}
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			end()
+		case c == '`':
+			if i+1 < len(b) && b[i+1] == '\n' {
+				i++
+				cont = true
+				continue
+			}
+			if i+2 < len(b) && b[i+1] == '\r' && b[i+2] == '\n' {
+				i += 2
+				cont = true
+				continue
+			}
+			begin(i)
+			if i+1 < len(b) {
+				i++
+				cur = append(cur, b[i])
+			}
+		case c == '\'':
+			begin(i)
+			quoted(TokenSingleQuoted)
+			j := i + 1
+			for ; j < len(b); j++ {
+				if b[j] == '\'' {
+					if j+1 < len(b) && b[j+1] == '\'' {
+						cur = append(cur, '\'')
+						j++
+						continue
+					}
+					break
+				}
+				cur = append(cur, b[j])
+			}
+			if j == len(b) {
+				return nil, fmt.Errorf("Unterminated single quote %s", position(b, i))
+			}
+			i = j
+		case c == '"':
+			begin(i)
+			quoted(TokenDoubleQuoted)
+			j := i + 1
+			for ; j < len(b); j++ {
+				if b[j] == '`' && j+1 < len(b) {
+					j++
+					cur = append(cur, powerShellEscape(b[j])...)
+					continue
+				}
+				if b[j] == '"' {
+					if j+1 < len(b) && b[j+1] == '"' {
+						cur = append(cur, '"')
+						j++
+						continue
+					}
+					break
+				}
+				cur = append(cur, b[j])
+			}
+			if j == len(b) {
+				return nil, fmt.Errorf("Unterminated double quote %s", position(b, i))
+			}
+			i = j
+		default:
+			begin(i)
+			cur = append(cur, c)
+		}
+	}
+	end()
+	return toks, nil
+}
+
+// powerShellEscape returns the bytes a backtick escape of c stands for inside a double-quoted string
+func powerShellEscape(c byte) []byte {
+	switch c {
+	case '0':
+		return []byte{0}
+	case 'a':
+		return []byte{'\a'}
+	case 'b':
+		return []byte{'\b'}
+	case 'e':
+		return []byte{0x1b}
+	case 'f':
+		return []byte{'\f'}
+	case 'n':
+		return []byte{'\n'}
+	case 'r':
+		return []byte{'\r'}
+	case 't':
+		return []byte{'\t'}
+	case 'v':
+		return []byte{'\v'}
+	}
+	return []byte{c}
+}
+
+// splitCommands splits input holding several curl commands, one after the other, into the individual
+// commands. A command ends at a newline that is neither inside quotes nor escaped by the line
+// continuation character of shell f. A trailing `;` or `&`, as DevTools puts between the commands of
+// "Copy all as cURL", is removed along with surrounding whitespace, and blank commands are dropped. If
+// max is positive, splitting stops with ok false as soon as more than max commands are found.
+func splitCommands(f Format, b []byte, max int) (cmds [][]byte, ok bool) {
+	esc := byte('\\')
+	switch f {
+	case FormatCmd:
+		esc = '^'
+	case FormatPowerShell:
+		esc = '`'
+	}
+	add := func(cmd []byte) bool {
+		cmd = bytes.TrimSpace(cmd)
+		cmd = bytes.TrimSpace(bytes.TrimRight(cmd, ";&"))
+		if len(cmd) == 0 {
+			return true
+		}
+		cmds = append(cmds, cmd)
+		return max <= 0 || len(cmds) <= max
+	}
+	var quote byte
+	start := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case quote == '$': // ANSI-C quote, closed by an unescaped single quote
+			if c == '\\' {
+				i++
+			} else if c == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			if c == esc || (c == '\\' && f != FormatCmd) {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		case c == esc:
+			i++
+		case c == '$' && f == FormatChromeBash && i+1 < len(b) && b[i+1] == '\'':
+			quote = '$'
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '\n':
+			if !add(b[start:i]) {
+				return cmds, false
+			}
+			start = i + 1
+		}
+	}
+	return cmds, add(b[start:])
+}
@@ -0,0 +1,429 @@
+package uncurl
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ResolveEntry is a parsed `--resolve host:port:addr[,addr]...` flag, pinning the addresses used to
+// connect to host on port
+type ResolveEntry struct {
+	Host      string
+	Port      string
+	Addresses []string
+}
+
+// parseResolve parses the argument of a --resolve flag
+func parseResolve(arg string) (ResolveEntry, error) {
+	parts := strings.SplitN(strings.TrimPrefix(arg, "+"), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return ResolveEntry{}, fmt.Errorf("Invalid --resolve argument %q, expected host:port:addr", arg)
+	}
+	re := ResolveEntry{Host: parts[0], Port: parts[1]}
+	for _, a := range strings.Split(parts[2], ",") {
+		re.Addresses = append(re.Addresses, strings.TrimSuffix(strings.TrimPrefix(a, "["), "]"))
+	}
+	return re, nil
+}
+
+// String returns the entry in the host:port:addr form --resolve takes, with IPv6 addresses bracketed
+func (re ResolveEntry) String() string {
+	addrs := make([]string, len(re.Addresses))
+	for i, a := range re.Addresses {
+		if strings.Contains(a, ":") {
+			a = "[" + a + "]"
+		}
+		addrs[i] = a
+	}
+	return re.Host + ":" + re.Port + ":" + strings.Join(addrs, ",")
+}
+
+// flagResolve handles --resolve, pinning a host and port to an address for DialTarget and Transport
+func (un *Uncurl) flagResolve(flag, arg string) error {
+	re, err := parseResolve(arg)
+	if err != nil {
+		return err
+	}
+	un.recordOrder("resolve")
+	un.resolves = append(un.resolves, re)
+	return nil
+}
+
+// Resolves returns the --resolve entries from the original curl string
+func (un *Uncurl) Resolves() []ResolveEntry {
+	rs := make([]ResolveEntry, len(un.resolves))
+	for i, re := range un.resolves {
+		rs[i] = re
+		rs[i].Addresses = append([]string(nil), re.Addresses...)
+	}
+	return rs
+}
+
+// resolveAddrs returns the addresses a dial of host:port in addr should be redirected to per the
+// --resolve entries, or nil if none applies
+func (un *Uncurl) resolveAddrs(addr string) []string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	for _, re := range un.resolves {
+		if strings.EqualFold(re.Host, host) && re.Port == port {
+			addrs := make([]string, len(re.Addresses))
+			for i, a := range re.Addresses {
+				addrs[i] = net.JoinHostPort(a, port)
+			}
+			return addrs
+		}
+	}
+	return nil
+}
+
+// Transport returns an *http.Transport configured from the curl flags, based on a clone of
+// http.DefaultTransport. Connections to a host and port named in a --resolve flag are made to the
+// pinned addresses instead; TLS still verifies against the original host name. With --interface,
+// connections are made from the given address or the first address of the named interface, and fail
+// if it has none.
+func (un *Uncurl) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{}
+	var ifaceErr error
+	if un.iface != "" {
+		var ip net.IP
+		if ip, ifaceErr = interfaceIP(un.iface); ifaceErr == nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if ifaceErr != nil {
+			return nil, ifaceErr
+		}
+		addrs := un.resolveAddrs(addr)
+		if addrs == nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		var err error
+		for _, a := range addrs {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, a); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+	return t
+}
+
+// flagInterface handles --interface, the interface name or address requests are sent from
+func (un *Uncurl) flagInterface(flag, arg string) error {
+	un.recordOrder("interface")
+	un.iface = arg
+	return nil
+}
+
+// Interface returns the argument of --interface, the network interface name or address requests are
+// sent from, or "" if none was given
+func (un *Uncurl) Interface() string {
+	return un.iface
+}
+
+// interfaceIP returns the local address named by an --interface argument: an IP address, or the first
+// address of an interface, preferring IPv4. The if! and host! prefixes of newer curl versions are
+// accepted.
+func interfaceIP(name string) (net.IP, error) {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "if!"), "host!")
+	if ip := net.ParseIP(name); ip != nil {
+		return ip, nil
+	}
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find --interface %s: %s", name, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list addresses of --interface %s: %s", name, err)
+	}
+	var found net.IP
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipn.IP.To4() != nil {
+			return ipn.IP, nil
+		}
+		if found == nil {
+			found = ipn.IP
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No address on --interface %s", name)
+	}
+	return found, nil
+}
+
+// curlCompressedEncodings is the Accept-Encoding curl sends for --compressed when none was captured
+const curlCompressedEncodings = "deflate, gzip, br"
+
+// EncodingChain returns the content codings the request accepts, lowercased and in the order given:
+// from the captured Accept-Encoding, or curl's default list if --compressed was given without one.
+// Parameters are dropped, as are codings refused with q=0. It is nil if neither was captured.
+func (un *Uncurl) EncodingChain() []string {
+	ae := un.AcceptEncoding
+	if ae == "" && un.compressed {
+		ae = curlCompressedEncodings
+	}
+	var chain []string
+	for _, e := range strings.Split(ae, ",") {
+		parts := strings.Split(e, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+		refused := false
+		for _, p := range parts[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(p), "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "q") {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+					refused = true
+				}
+			}
+		}
+		if !refused {
+			chain = append(chain, name)
+		}
+	}
+	return chain
+}
+
+// DecompressingTransport returns a RoundTripper reproducing curl's --compressed behavior: requests
+// carry the captured Accept-Encoding (or curl's default list if --compressed was given without one),
+// and gzip, deflate and br response bodies are decoded before being handed to the caller. A decoded
+// response has its Content-Encoding and Content-Length removed and Uncompressed set. Responses without
+// a body, to HEAD requests or with a 204 or 304 status, are handed over as they are. Connections are
+// made by Transport().
+func (un *Uncurl) DecompressingTransport() http.RoundTripper {
+	t := un.Transport()
+	t.DisableCompression = true
+	return &decompressingTransport{un: un, next: t}
+}
+
+type decompressingTransport struct {
+	un   *Uncurl
+	next http.RoundTripper
+}
+
+func (d *decompressingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Header.Get("Accept-Encoding") == "" {
+		ae := d.un.AcceptEncoding
+		if ae == "" && d.un.compressed {
+			ae = curlCompressedEncodings
+		}
+		if ae != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Accept-Encoding", ae)
+		}
+	}
+	resp, err := d.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	ce := resp.Header.Get("Content-Encoding")
+	if ce == "" || !hasBody(r, resp) {
+		return resp, nil
+	}
+	encs := strings.Split(ce, ",")
+	body := io.ReadCloser(resp.Body)
+	for i := len(encs) - 1; i >= 0; i-- { // codings are listed in the order they were applied
+		dec, err := decodeContent(strings.TrimSpace(encs[i]), body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Error decoding %s response body: %s", encs[i], err)
+		}
+		if dec == nil { // unsupported coding, hand the body over as-is
+			return resp, nil
+		}
+		body = dec
+	}
+	resp.Body = &decodedBody{ReadCloser: body, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// hasBody reports whether resp, the response to r, can carry a body to decode: HEAD responses and 204
+// and 304 responses never do, whatever their Content-Encoding says, and neither does an empty one
+func hasBody(r *http.Request, resp *http.Response) bool {
+	return r.Method != http.MethodHead && resp.StatusCode != http.StatusNoContent &&
+		resp.StatusCode != http.StatusNotModified && resp.ContentLength != 0
+}
+
+// decodeContent wraps r in a decoder for the content coding enc. It returns a nil ReadCloser if enc is
+// not supported.
+func decodeContent(enc string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(enc) {
+	case "identity":
+		return ioutil.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// deflate is meant to be zlib-wrapped, but some servers send a raw stream; tell them apart by
+		// the zlib header
+		br := bufio.NewReader(r)
+		if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	case "br":
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
+	}
+	return nil, nil
+}
+
+// decodedBody closes both the decoder chain and the underlying response body
+type decodedBody struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.raw.Close()
+}
+
+// DialTarget returns the network and address a raw connection for the request would be opened to:
+// "tcp" and the target's host:port, with the scheme's default port filled in, or the first pinned
+// address if a --resolve entry matches
+func (un *Uncurl) DialTarget() (network, address string) {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return "", ""
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	address = net.JoinHostPort(u.Hostname(), port)
+	if addrs := un.resolveAddrs(address); addrs != nil {
+		address = addrs[0]
+	}
+	return "tcp", address
+}
+
+// defaultPorts maps URL schemes to the port curl connects to when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// flagMaxTime handles -m, the limit in seconds, possibly fractional, on the whole request
+func (un *Uncurl) flagMaxTime(flag, arg string) error {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || secs < 0 {
+		return fmt.Errorf("Invalid %s argument %q, expected a number of seconds", flag, arg)
+	}
+	un.recordOrder("max-time")
+	un.maxTime = time.Duration(secs * float64(time.Second))
+	return nil
+}
+
+// MaxTime returns the limit set with -m/--max-time, or 0 if there is none
+func (un *Uncurl) MaxTime() time.Duration {
+	return un.maxTime
+}
+
+// flagLocation handles -L, having Client follow redirects
+func (un *Uncurl) flagLocation(flag, arg string) error {
+	un.recordOrder("location")
+	un.location = true
+	return nil
+}
+
+// flagMaxRedirs handles --max-redirs, the number of redirects Client follows with -L, -1 for no limit
+func (un *Uncurl) flagMaxRedirs(flag, arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < -1 {
+		return fmt.Errorf("Invalid %s argument %q, expected a number of redirects", flag, arg)
+	}
+	un.recordOrder("max-redirs")
+	un.maxRedirs, un.hasMaxRedirs = n, true
+	return nil
+}
+
+// MaxRedirects returns the limit set with --max-redirs, or -1 if there is none. As in curl, an explicit
+// -1 also means no limit.
+func (un *Uncurl) MaxRedirects() int {
+	if !un.hasMaxRedirs {
+		return -1
+	}
+	return un.maxRedirs
+}
+
+// Client returns an *http.Client sending requests through Transport, or DecompressingTransport if
+// --compressed was given. Its Timeout is the --max-time of the curl string, or else the WithTimeout
+// option. As in curl, redirects are only followed with -L: without it the redirect response itself is
+// returned. With -L and --max-redirs, its CheckRedirect stops after that many redirects; with -L alone
+// net/http's default policy applies.
+func (un *Uncurl) Client() *http.Client {
+	c := &http.Client{Transport: un.Transport(), Timeout: un.opts.timeout}
+	if un.compressed {
+		c.Transport = un.DecompressingTransport()
+	}
+	if un.maxTime > 0 {
+		c.Timeout = un.maxTime
+	}
+	if !un.location {
+		c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else if n := un.MaxRedirects(); n >= 0 {
+		c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return fmt.Errorf("Maximum (%d) redirects followed", n)
+			}
+			return nil
+		}
+	} else if un.hasMaxRedirs {
+		c.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			return nil
+		}
+	}
+	return c
+}
+
+// Do sends the request with c, or with the client from Client if c is nil
+func (un *Uncurl) Do(c *http.Client) (*http.Response, error) {
+	if c == nil {
+		c = un.Client()
+	}
+	return c.Do(un.Request())
+}
+
+// UnixRequest returns the request, with its original URL and headers, and a client whose transport
+// connects every request to the unix domain socket at socketPath, as curl does with --unix-socket. The
+// host in the URL is still sent in the Host header.
+func (un *Uncurl) UnixRequest(socketPath string) (*http.Request, *http.Client) {
+	t := un.Transport()
+	dialer := &net.Dialer{}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+	return un.Request(), &http.Client{Transport: t}
+}
@@ -10,33 +10,39 @@
 package uncurl
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	// these patterns match output from Chrome/Chromium
-	curlHeaderPattern = `-H\s+'([^:]+?):\s+(.+?)'`
-	curlTargetPattern = `^\s*curl\s+'([^']+?)' `
-	curlDataPattern   = ` --data '([^']+?)' `
-
 	curlAcceptEncodingPattern = `(?i)^\s*accept-encoding\s*$`
+
+	// matches a `{name}` placeholder in a templated target path
+	curlPathParamPattern = `\{[^{}/]+\}`
 )
 
-var curlHeaderRe, curlTargetRe, curlDataRe, curlAcceptEncodingRe *regexp.Regexp
+var curlAcceptEncodingRe, curlPathParamRe *regexp.Regexp
 
 func init() {
-	curlHeaderRe = regexp.MustCompile(curlHeaderPattern)
-	curlTargetRe = regexp.MustCompile(curlTargetPattern)
-	curlDataRe = regexp.MustCompile(curlDataPattern)
 	curlAcceptEncodingRe = regexp.MustCompile(curlAcceptEncodingPattern)
+	curlPathParamRe = regexp.MustCompile(curlPathParamPattern)
 }
 
 // Uncurl is the object from which requests are generated. Create one with New
@@ -54,6 +60,80 @@ type Uncurl struct {
 	// body is the original body
 	body []byte
 
+	// rawData is the body as given in the data flags, before newline stripping
+	rawData []byte
+
+	// dataFlag is the flag the body was given with, e.g. --data or --data-raw
+	dataFlag string
+
+	// cookies holds the cookies attached with AddCookie or read from stdin by -b @-
+	cookies []*http.Cookie
+
+	// format is how the curl string was interpreted
+	format Format
+
+	// resolves holds the parsed --resolve flags
+	resolves []ResolveEntry
+
+	// compressed records whether the --compressed flag was present
+	compressed bool
+
+	// includeHeaders records whether -i/--include was present
+	includeHeaders bool
+
+	// configDepth is the nesting depth of -K config files being read
+	configDepth int
+
+	// configName is the outermost -K config file being read, as named in the curl string
+	configName string
+
+	// warnings collects diagnostics about parts of the curl string that were ambiguous or ignored
+	warnings []string
+
+	// order lists the keys of the flags that were given, in order, so Curl can re-emit them as written
+	order []string
+
+	// tokenKinds is the quoting of each word of the curl string. argKind is the quoting of the
+	// argument being applied, and argKinds that of the first argument of each key in order.
+	tokenKinds []TokenKind
+	argKind    TokenKind
+	argKinds   map[string]TokenKind
+
+	// proxies holds the proxy flags, in order
+	proxies []proxyFlag
+
+	// insecure records whether -k/--insecure was present
+	insecure bool
+
+	// iface is the --interface argument
+	iface string
+
+	// location records whether -L/--location was present
+	location bool
+
+	// maxRedirs is the --max-redirs limit, or -1 for none; hasMaxRedirs is true if the flag was given
+	maxRedirs    int
+	hasMaxRedirs bool
+
+	// maxTime is the --max-time limit on the whole transfer, or 0 if none was given
+	maxTime time.Duration
+
+	// jsonBody is true when the body came from --json
+	jsonBody bool
+
+	// defaults are the headers flags such as -u and -r send unless the command gives them with -H,
+	// applied once all flags are read
+	defaults []headerDefault
+
+	// multiline is true when the curl string was split over lines with continuations
+	multiline bool
+
+	// ignored lists the flags that were recognized but have no effect on the request
+	ignored []string
+
+	// opts holds the Options passed to New
+	opts options
+
 	// AcceptEncoding is the original `accept-encoding` header value. Including this header on our Go
 	// request would signal to the `net/http` package that we do not wish to use DefaultTransport for
 	// our request, disabling automatic gzip handling. As that's not usually desired, the value is
@@ -63,39 +143,38 @@ type Uncurl struct {
 
 // New generates a new Uncurl object from a Chrome/Chromium "Copy as cURL" input as bytes.
 // This is useful when you're loading from a file or concerned about efficiency. If you prefer to pass
-// string input instead, use NewString.
-func New(b []byte) (*Uncurl, error) {
+// string input instead, use NewString. Options may be passed to adjust parsing and request generation.
+func New(b []byte, opts ...Option) (*Uncurl, error) {
 	if b == nil || len(b) == 0 {
 		return nil, errors.New("New called with empty parameter")
 	}
 	un := new(Uncurl)
+	for _, opt := range opts {
+		opt(&un.opts)
+	}
 	un.input = b
-	un.method = `GET`
-	cm := curlTargetRe.FindSubmatch(b)
-	if len(cm) < 2 {
+	un.header = make(http.Header)
+	if err := un.parse(b); err != nil {
+		return nil, err
+	}
+	if un.target == "" {
 		return nil, fmt.Errorf("Failed to find target URL in curl string %s", b)
 	}
-	un.target = string(cm[1])
-	if _, err := url.ParseRequestURI(un.target); err != nil {
-		return nil, fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	un.target = un.encodeSpaces(un.target)
+	if err := un.resolveTarget(); err != nil {
+		return nil, err
 	}
-	h := make(http.Header)
-	all := curlHeaderRe.FindAllSubmatch(b, -1)
-	for _, m := range all {
-		if m[1] == nil {
-			continue
-		}
-		if curlAcceptEncodingRe.Match(m[1]) { // use default Transport
-			un.AcceptEncoding = string(m[2])
-			continue
-		}
-		h[string(m[1])] = []string{string(m[2])}
+	if err := un.checkTarget(un.target); err != nil {
+		return nil, err
+	}
+	if un.method == "" {
+		un.method = un.impliedMethod()
 	}
-	un.header = h
-	dm := curlDataRe.FindSubmatch(b)
-	if len(dm) == 2 {
-		un.method = `POST`
-		un.body = dm[1]
+	if un.compressed && strings.EqualFold(strings.TrimSpace(un.AcceptEncoding), "identity") {
+		un.warn("--compressed conflicts with explicit Accept-Encoding: identity; keeping the header value")
+	}
+	if err := un.checkContentLength(); err != nil {
+		return nil, err
 	}
 	_, err := http.NewRequest(un.method, un.target, un.bodyReadCloser())
 	if err != nil {
@@ -104,9 +183,201 @@ func New(b []byte) (*Uncurl, error) {
 	return un, nil
 }
 
+// checkContentLength compares a captured Content-Length header with the body. A header that does not
+// match, which can happen after a capture is edited, is an error under WithStrict; otherwise it is
+// dropped with a warning, and requests carry the true length.
+func (un *Uncurl) checkContentLength() error {
+	v := un.headerValues("Content-Length")
+	if v == nil {
+		return nil
+	}
+	if len(v) == 1 && strings.TrimSpace(v[0]) == strconv.Itoa(len(un.body)) {
+		return nil
+	}
+	if un.opts.strict {
+		return fmt.Errorf("Content-Length header %s does not match body length %d", strings.Join(v, ", "), len(un.body))
+	}
+	un.warn("Dropping Content-Length header %s, which does not match body length %d", strings.Join(v, ", "), len(un.body))
+	un.delHeader("Content-Length")
+	return nil
+}
+
+// encodeSpaces percent-encodes the literal spaces of target under WithURLSpaceEncoding
+func (un *Uncurl) encodeSpaces(target string) string {
+	if !un.opts.urlSpaceEncoding {
+		return target
+	}
+	return strings.Replace(target, " ", "%20", -1)
+}
+
+// resolveTarget resolves a relative target against the WithBaseURL base, if one was given
+func (un *Uncurl) resolveTarget() error {
+	if un.opts.baseURL == "" {
+		return nil
+	}
+	ref, err := url.Parse(un.target)
+	if err != nil {
+		return fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	}
+	if ref.IsAbs() {
+		return nil
+	}
+	base, err := url.Parse(un.opts.baseURL)
+	if err != nil {
+		return fmt.Errorf("Base url %s failed to parse: %s", un.opts.baseURL, err)
+	}
+	un.target = base.ResolveReference(ref).String()
+	return nil
+}
+
 // NewString generates a new Uncurl object from a Chrome/Chromium "Copy as cURL" string
-func NewString(s string) (*Uncurl, error) {
-	return New([]byte(s))
+func NewString(s string, opts ...Option) (*Uncurl, error) {
+	return New([]byte(s), opts...)
+}
+
+// FromRequest builds an Uncurl from an existing request, copying its method, URL, headers and body,
+// so that e.g. Curl() can turn any Go request into a curl command. The body is read through GetBody
+// when available; otherwise r.Body is consumed and replaced with an equivalent reader. A Host that
+// differs from the URL's is kept as a Host header, which Request() maps back to the Host. The URL is
+// checked as New checks a parsed target, so WithAllowedSchemes and WithURLSpaceEncoding apply. String()
+// returns the Curl() rendering, and Format() reports FormatUnknown.
+func FromRequest(r *http.Request, opts ...Option) (*Uncurl, error) {
+	if r == nil || r.URL == nil {
+		return nil, errors.New("FromRequest called with nil request or URL")
+	}
+	un := new(Uncurl)
+	for _, opt := range opts {
+		opt(&un.opts)
+	}
+	un.method = r.Method
+	if un.method == "" {
+		un.method = `GET`
+	}
+	un.target = un.encodeSpaces(r.URL.String())
+	if err := un.checkTarget(un.target); err != nil {
+		return nil, err
+	}
+	un.header = make(http.Header)
+	for k, v := range r.Header {
+		if strings.EqualFold(k, "Host") {
+			// net/http sends r.Host instead, which is carried below
+			continue
+		}
+		if curlAcceptEncodingRe.MatchString(k) {
+			un.AcceptEncoding = strings.Join(v, ", ")
+			if !un.opts.acceptEncodingInHeader() {
+				continue
+			}
+		}
+		un.header[un.headerName(k)] = append([]string(nil), v...)
+	}
+	if r.Host != "" && r.Host != r.URL.Host {
+		un.header[un.headerName("Host")] = []string{r.Host}
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		var body io.ReadCloser = r.Body
+		if r.GetBody != nil {
+			var err error
+			if body, err = r.GetBody(); err != nil {
+				return nil, fmt.Errorf("Error getting request body: %s", err)
+			}
+		}
+		b, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error reading request body: %s", err)
+		}
+		if r.GetBody == nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		}
+		un.body = b
+		un.rawData = b
+		un.dataFlag = "--data-raw"
+	}
+	un.input = []byte(un.Curl())
+	return un, nil
+}
+
+// NewUncurlAll parses input holding several curl commands, one after another, such as the output of
+// DevTools' "Copy all as cURL". Commands are separated by newlines that are not quoted or continued.
+// The options apply to every command; see WithMaxCommands to bound the number accepted. Parsing stops
+// at the first command that fails, and the error names its position.
+func NewUncurlAll(b []byte, opts ...Option) ([]*Uncurl, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cmds, ok := splitCommands(detectShell(b), b, o.maxCommands)
+	if !ok {
+		return nil, fmt.Errorf("Input contains more than %d commands", o.maxCommands)
+	}
+	if len(cmds) == 0 {
+		return nil, errors.New("NewUncurlAll called without any commands")
+	}
+	uns := make([]*Uncurl, len(cmds))
+	for i, cmd := range cmds {
+		un, err := New(cmd, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("Command %d: %s", i+1, err)
+		}
+		uns[i] = un
+	}
+	return uns, nil
+}
+
+// NewUncurlStream reads newline-delimited curl commands from r and parses each one, sending the
+// results on the returned *Uncurl channel. A line beginning with a double quote is decoded as a JSON
+// string first, so NDJSON dumps of commands work too. Blank lines are skipped. A line that fails to
+// parse produces an error on the error channel, prefixed with its line number, and the stream
+// continues. Both channels are closed once r is exhausted or fails to read; callers must receive from
+// both until they are closed. Each command is parsed with opts.
+func NewUncurlStream(r io.Reader, opts ...Option) (<-chan *Uncurl, <-chan error) {
+	out := make(chan *Uncurl)
+	errs := make(chan error)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		br := bufio.NewReader(r)
+		for n := 1; ; n++ {
+			line, err := br.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				un, perr := newStreamLine(bytes.TrimSpace(line), opts)
+				if perr != nil {
+					errs <- fmt.Errorf("Line %d: %s", n, perr)
+				} else {
+					out <- un
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- fmt.Errorf("Error reading stream at line %d: %s", n, err)
+				return
+			}
+		}
+	}()
+	return out, errs
+}
+
+// newStreamLine parses a single NewUncurlStream line, decoding it first if it's a JSON string
+func newStreamLine(line []byte, opts []Option) (*Uncurl, error) {
+	if line[0] != '"' {
+		return New(line, opts...)
+	}
+	var s string
+	if err := json.Unmarshal(line, &s); err != nil {
+		return nil, fmt.Errorf("Failed to decode JSON string: %s", err)
+	}
+	return NewString(s, opts...)
+}
+
+// bodyReader returns a reader over the body that http.NewRequest can size, or nil if there is no body
+func (un *Uncurl) bodyReader() io.Reader {
+	if un.body == nil {
+		return nil
+	}
+	return bytes.NewReader(un.body)
 }
 
 func (un *Uncurl) bodyReadCloser() io.ReadCloser {
@@ -118,7 +389,8 @@ func (un *Uncurl) bodyReadCloser() io.ReadCloser {
 }
 
 // Header creates a new http.Header map and copies all headers from the original curl, with the
-// exception of Accept-Encoding, to it
+// exception of Accept-Encoding unless WithKeepAcceptEncoding or WithAcceptEncodingInHeader was used, to
+// it
 func (un *Uncurl) Header() http.Header {
 	h := make(http.Header)
 	for k, v := range un.header {
@@ -129,11 +401,153 @@ func (un *Uncurl) Header() http.Header {
 	return h
 }
 
+// requestHeader is Header() as put on generated requests: an Accept-Encoding placed in the header map
+// by WithAcceptEncodingInHeader alone is removed, so the transport's transparent gzip still applies
+func (un *Uncurl) requestHeader() http.Header {
+	h := un.Header()
+	if un.opts.keepAcceptEncoding {
+		return h
+	}
+	for k := range h {
+		if curlAcceptEncodingRe.MatchString(k) {
+			delete(h, k)
+		}
+	}
+	return h
+}
+
+// mapAuthority moves a captured Host header, which net/http ignores in r.Header, and a captured
+// authority header, which is how Chrome shows the HTTP/2 :authority pseudo-header, to the Host of r.
+// The authority header wins when both are present. It is not a real header, so it is dropped from r's
+// header unless WithKeepAuthorityHeader is set, in which case it is left alone and does not set the Host.
+func (un *Uncurl) mapAuthority(r *http.Request) {
+	authority := ""
+	for k, v := range r.Header {
+		switch {
+		case strings.EqualFold(k, "Host"):
+			if len(v) > 0 && v[0] != "" && authority == "" {
+				r.Host = v[0]
+			}
+		case strings.EqualFold(k, "authority") && !un.opts.keepAuthority:
+			if len(v) > 0 && v[0] != "" {
+				r.Host, authority = v[0], v[0]
+			}
+		default:
+			continue
+		}
+		delete(r.Header, k)
+	}
+}
+
+// authorityHost removes from h, a copy of the captured headers being rendered, the headers a request
+// does not send as such: pseudo-headers, and the authority header unless WithKeepAuthorityHeader is set.
+// It returns the Host the authority header stands for, as mapAuthority sets it, or "" if there is none.
+func (un *Uncurl) authorityHost(h map[string][]string) string {
+	host := ""
+	for k, v := range h {
+		switch {
+		case strings.HasPrefix(k, ":"):
+		case strings.EqualFold(k, "authority") && !un.opts.keepAuthority:
+			if len(v) > 0 {
+				host = v[0]
+			}
+		default:
+			continue
+		}
+		delete(h, k)
+	}
+	return host
+}
+
+// headerKeys returns the captured header names in sorted order, for output that must not depend on
+// map iteration order
+func (un *Uncurl) headerKeys() []string {
+	return sortedKeys(un.header)
+}
+
+// sortedKeys returns the names of h in sorted order
+func sortedKeys(h map[string][]string) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SortedHeaders returns the headers of Header() as "Key: value" lines sorted alphabetically, giving
+// output that is stable regardless of map ordering
+func (un *Uncurl) SortedHeaders() []string {
+	var lines []string
+	for k, v := range un.header {
+		for _, s := range v {
+			lines = append(lines, k+": "+s)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// headerValues returns the values of the captured header matching key case-insensitively. Captured
+// keys keep the casing from the curl string (Chrome sends lowercase names for HTTP/2), so http.Header's
+// canonicalizing Get can't be used.
+func (un *Uncurl) headerValues(key string) []string {
+	for k, v := range un.header {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// addHeader appends value to the captured header matching key case-insensitively, keeping the casing
+// it was first captured with, or adds the header under key if there is none
+func (un *Uncurl) addHeader(key, value string) {
+	for k := range un.header {
+		if strings.EqualFold(k, key) {
+			un.header[k] = append(un.header[k], value)
+			return
+		}
+	}
+	un.header[key] = []string{value}
+}
+
+// delHeader removes every captured header matching key case-insensitively
+func (un *Uncurl) delHeader(key string) {
+	for k := range un.header {
+		if strings.EqualFold(k, key) {
+			delete(un.header, k)
+		}
+	}
+}
+
+// headerGet returns the first value of the captured header matching key case-insensitively, or "" if
+// absent
+func (un *Uncurl) headerGet(key string) string {
+	if v := un.headerValues(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// IsXHR reports whether the captured request looks like an XHR/fetch API call rather than a page load,
+// based on an `X-Requested-With: XMLHttpRequest` or `Sec-Fetch-Mode: cors` header
+func (un *Uncurl) IsXHR() bool {
+	return strings.EqualFold(un.headerGet("X-Requested-With"), "XMLHttpRequest") ||
+		strings.EqualFold(un.headerGet("Sec-Fetch-Mode"), "cors")
+}
+
 // String satisfies the `fmt.Stringer` interface by returning the original curl string
 func (un *Uncurl) String() string {
 	return string(un.input)
 }
 
+// WasMultiline reports whether the original curl string was split over several lines with line
+// continuations, as DevTools does when copying. String returns such input with its line breaks intact.
+func (un *Uncurl) WasMultiline() bool {
+	return un.multiline
+}
+
 // Target returns the URL from the original curl string
 func (un *Uncurl) Target() string {
 	return un.target
@@ -144,6 +558,33 @@ func (un *Uncurl) Method() string {
 	return un.method
 }
 
+// IncludeResponseHeaders reports whether the original curl string asked for response headers to be
+// included in the output with -i/--include. It has no effect on the generated request.
+func (un *Uncurl) IncludeResponseHeaders() bool {
+	return un.includeHeaders
+}
+
+// Compressed reports whether the original curl string included the --compressed flag
+func (un *Uncurl) Compressed() bool {
+	return un.compressed
+}
+
+// Warnings returns diagnostics noted while parsing the curl string, such as conflicting flags. The
+// slice is empty if the input was unambiguous.
+func (un *Uncurl) Warnings() []string {
+	w := make([]string, len(un.warnings))
+	copy(w, un.warnings)
+	return w
+}
+
+func (un *Uncurl) warn(format string, a ...interface{}) {
+	if un.configDepth > 0 {
+		// the message may quote the contents of a config file, which are not to be echoed
+		format, a = "Ignoring part of config file %s", []interface{}{un.configName}
+	}
+	un.warnings = append(un.warnings, fmt.Sprintf(format, a...))
+}
+
 // Body returns a copy of the --data argument from the original curl string. The slice will be empty if
 // --data was not present.
 func (un *Uncurl) Body() []byte {
@@ -152,16 +593,179 @@ func (un *Uncurl) Body() []byte {
 	return b
 }
 
+// BodyPrefix returns a copy of at most the first n bytes of the body, without copying the rest. It is
+// handy for logging large payloads.
+func (un *Uncurl) BodyPrefix(n int) []byte {
+	if n > len(un.body) {
+		n = len(un.body)
+	}
+	if n < 0 {
+		n = 0
+	}
+	b := make([]byte, n)
+	copy(b, un.body)
+	return b
+}
+
+// RawData returns a copy of the data flag values exactly as given in the curl string. It differs from
+// Body() when a --data value had newlines stripped. The slice is empty if there was no data flag.
+func (un *Uncurl) RawData() []byte {
+	b := make([]byte, len(un.rawData))
+	copy(b, un.rawData)
+	return b
+}
+
 // Request returns the Go `*http.Request` version of the curl
 func (un *Uncurl) Request() *http.Request {
-	r, _ := un.NewRequest(un.method, un.target, un.bodyReadCloser()) // as all relevant variables are private, we can rely on the error check done in New
-	r.Header = un.Header()
+	r, _ := un.requestTo(un.target) // as all relevant variables are private, we can rely on the error check done in New
+	return r
+}
+
+// requestTo builds the request described by the curl, but sent to target
+func (un *Uncurl) requestTo(target string) (*http.Request, error) {
+	r, err := un.NewRequest(un.method, target, un.bodyReader())
+	if err != nil {
+		return nil, err
+	}
+	if un.body == nil {
+		return r, nil
+	}
 	r.GetBody = func() (io.ReadCloser, error) {
 		return un.bodyReadCloser(), nil
 	}
+	if un.opts.chunkedBody {
+		// a length of -1 and a body of a type net/http can't size forces chunked encoding
+		r.ContentLength = -1
+		r.Body = un.bodyReadCloser()
+	}
+	return r, nil
+}
+
+// Replayable returns the request together with a function that returns a fresh reader over the body
+// each time it is called, for retry loops that resend the body by hand. Without a body it returns
+// http.NoBody.
+func (un *Uncurl) Replayable() (*http.Request, func() io.ReadCloser) {
+	return un.Request(), func() io.ReadCloser {
+		if un.body == nil {
+			return http.NoBody
+		}
+		return un.bodyReadCloser()
+	}
+}
+
+// RequestWithEncoding is like Request(), but sends an Accept-Encoding of enc, such as "gzip", in place
+// of any captured one, to see how a server behaves under a single encoding. As with any explicit
+// Accept-Encoding, net/http then leaves the response body as the server sent it.
+func (un *Uncurl) RequestWithEncoding(enc string) *http.Request {
+	r := un.Request()
+	for k := range r.Header {
+		if curlAcceptEncodingRe.MatchString(k) {
+			delete(r.Header, k)
+		}
+	}
+	r.Header.Set("Accept-Encoding", enc)
+	return r
+}
+
+// RequestWithHeaders is like Request(), but with the headers in overrides replacing any captured header
+// of the same name, compared case-insensitively, and the other captured headers kept. A Host override
+// sets the request Host. The Uncurl itself is not changed.
+func (un *Uncurl) RequestWithHeaders(overrides http.Header) *http.Request {
+	r := un.Request()
+	for ok, ov := range overrides {
+		for k := range r.Header {
+			if strings.EqualFold(k, ok) {
+				delete(r.Header, k)
+			}
+		}
+		if strings.EqualFold(ok, "Host") {
+			if len(ov) > 0 {
+				r.Host = ov[0]
+			}
+			continue
+		}
+		r.Header[ok] = append([]string(nil), ov...)
+	}
+	return r
+}
+
+// RequestWithBody is like Request(), but streams body instead of the captured body, without buffering
+// it. ContentLength is set to length, which may be -1 if unknown. If body implements io.Seeker,
+// GetBody is set to rewind it to its current position, so redirects and retries can replay it;
+// otherwise GetBody is left nil. A seekable body must outlive each attempt, so the request never
+// closes it and the caller closes it once the response is handled.
+func (un *Uncurl) RequestWithBody(body io.ReadCloser, length int64) *http.Request {
+	r, _ := un.NewRequest(un.method, un.target, body) // as all relevant variables are private, we can rely on the error check done in New
+	if body == nil {
+		return r
+	}
+	r.ContentLength = length
+	if s, ok := body.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			r.Body = ioutil.NopCloser(body)
+			r.GetBody = func() (io.ReadCloser, error) {
+				if _, err := s.Seek(start, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return ioutil.NopCloser(body), nil
+			}
+		}
+	}
 	return r
 }
 
+// SetTarget replaces the URL requests are generated for. It may contain `{name}` path placeholders for
+// use with RequestWithParams.
+func (un *Uncurl) SetTarget(target string) error {
+	target = un.encodeSpaces(target)
+	if err := un.checkTarget(target); err != nil {
+		return err
+	}
+	un.target = target
+	return nil
+}
+
+// checkTarget validates target as a request URL whose scheme is permitted by WithAllowedSchemes
+func (un *Uncurl) checkTarget(target string) error {
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return fmt.Errorf("Target url %s failed to parse: %s", target, err)
+	}
+	if un.opts.schemes == nil {
+		return nil
+	}
+	for _, s := range un.opts.schemes {
+		if strings.EqualFold(s, u.Scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Target url %s has disallowed scheme %q", target, u.Scheme)
+}
+
+// RequestWithParams is like Request(), but first replaces each `{name}` placeholder in the path of the
+// target with the path-escaped value of params[name]. Placeholders are typically inserted with
+// SetTarget. It is an error for a placeholder to have no matching parameter.
+func (un *Uncurl) RequestWithParams(params map[string]string) (*http.Request, error) {
+	path, rest := un.target, ""
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path, rest = path[:i], path[i:]
+	}
+	var missing []string
+	path = curlPathParamRe.ReplaceAllStringFunc(path, func(m string) string {
+		name := m[1 : len(m)-1]
+		v, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		return url.PathEscape(v)
+	})
+	if missing != nil {
+		return nil, fmt.Errorf("No value for path parameters %s", strings.Join(missing, ", "))
+	}
+	return un.requestTo(path + rest)
+}
+
 // NewRequest is like Request(), but allows the caller to set the method, url, and body; matching the
 // function signature of http.NewRequest
 func (un *Uncurl) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
@@ -169,7 +773,9 @@ func (un *Uncurl) NewRequest(method, url string, body io.Reader) (*http.Request,
 	if err != nil {
 		return nil, fmt.Errorf("Error building request: %s", err)
 	}
-	r.Header = un.Header()
+	r.Header = un.requestHeader()
+	un.mapAuthority(r)
+	un.addCookies(r)
 	return r, nil
 }
 
@@ -180,6 +786,277 @@ func (un *Uncurl) NewRequestWithContext(ctx context.Context, method, url string,
 	if err != nil {
 		return nil, fmt.Errorf("Error building request: %s", err)
 	}
-	r.Header = un.Header()
+	r.Header = un.requestHeader()
+	un.mapAuthority(r)
+	un.addCookies(r)
 	return r, nil
 }
+
+// Hash returns a SHA-256 hex digest identifying the request by its method, normalized URL, headers and
+// body. Header names are canonicalized and sorted, and the scheme and host are lowercased, so commands
+// differing only in header order or casing hash equally. Accept-Encoding and -b cookies are included.
+func (un *Uncurl) Hash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", un.method, normalizeURL(un.target))
+	var lines []string
+	for k, v := range un.headerWithCookies() {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		for _, s := range v {
+			lines = append(lines, ck+": "+s)
+		}
+	}
+	if un.AcceptEncoding != "" && un.headerValues("Accept-Encoding") == nil {
+		lines = append(lines, "Accept-Encoding: "+un.AcceptEncoding)
+	}
+	sort.Strings(lines)
+	for _, l := range lines {
+		fmt.Fprintf(h, "%s\n", l)
+	}
+	fmt.Fprintf(h, "\n")
+	h.Write(un.body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReferencedURLs returns every URL the command refers to, for security review: the target, then the
+// Referer and Origin headers and the -x/--proxy and --preproxy arguments, in that order. Each URL is
+// listed once, as written.
+func (un *Uncurl) ReferencedURLs() []string {
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(u string) {
+		if u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	add(un.target)
+	for _, k := range []string{"Referer", "Origin"} {
+		for _, v := range un.headerValues(k) {
+			add(strings.TrimSpace(v))
+		}
+	}
+	for _, p := range un.proxies {
+		add(p.url)
+	}
+	return urls
+}
+
+// CacheKey returns the key an HTTP cache would store the response under: the method and the target
+// URL, with the scheme and host lowercased and any fragment removed. If vary names the headers listed
+// in a response's Vary header, their captured values are appended, one `name: value` line each, so
+// requests that differ in those headers get different keys.
+func (un *Uncurl) CacheKey(vary ...string) string {
+	target := un.target
+	if u, err := url.Parse(target); err == nil {
+		u.Fragment = ""
+		target = u.String()
+	}
+	key := strings.ToUpper(un.method) + " " + normalizeURL(target)
+	for _, name := range vary {
+		key += "\n" + strings.ToLower(name) + ": " + strings.Join(un.headerValues(name), ",")
+	}
+	return key
+}
+
+// SameEndpoint reports whether other is sent to the same endpoint: the same method, scheme, host and
+// port, and path, ignoring the query, fragment and headers. Scheme, host and method are compared
+// case-insensitively, and a default port matches its omission.
+func (un *Uncurl) SameEndpoint(other *Uncurl) bool {
+	a, err := url.Parse(un.target)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(other.target)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(un.method, other.method) && strings.EqualFold(a.Scheme, b.Scheme) &&
+		endpointHost(a) == endpointHost(b) && endpointPath(a) == endpointPath(b)
+}
+
+// endpointHost returns the lowercased host and port of u, supplying the scheme's default port
+func endpointHost(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// endpointPath returns the escaped path of u, with an empty path standing for /
+func endpointPath(u *url.URL) string {
+	if p := u.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+// normalizeURL lowercases the scheme and host of target, returning it unchanged if it fails to parse
+func normalizeURL(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u.String()
+}
+
+// SNIHost returns the hostname that would be sent for TLS SNI: the host of a captured Host or
+// authority header if present, since those override the host being addressed, and otherwise the host
+// of the target URL. Any port is removed.
+func (un *Uncurl) SNIHost() string {
+	for _, k := range []string{"Host", ":authority", "authority"} {
+		if h := un.headerGet(k); h != "" {
+			return (&url.URL{Host: h}).Hostname()
+		}
+	}
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// RemoteName returns the file name curl's -O flag would save the response to: the last segment of the
+// target's path, or index.html if the path ends in a slash or is empty
+func (un *Uncurl) RemoteName() string {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return ""
+	}
+	p := u.EscapedPath()
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		p = p[i+1:]
+	}
+	if p == "" {
+		return "index.html"
+	}
+	return p
+}
+
+// MergeHeaders copies headers from other into un. With keys, each named header present in other
+// replaces any header of the same name in un, matching names case-insensitively. Without keys, every
+// header of other that un lacks is added.
+func (un *Uncurl) MergeHeaders(other *Uncurl, keys ...string) {
+	if len(keys) == 0 {
+		for k, v := range other.header {
+			if un.headerValues(k) == nil {
+				un.header[k] = append([]string(nil), v...)
+			}
+		}
+		return
+	}
+	for _, key := range keys {
+		for k, v := range other.header {
+			if strings.EqualFold(k, key) {
+				un.delHeader(key)
+				un.header[k] = append([]string(nil), v...)
+				break
+			}
+		}
+	}
+}
+
+// IsIdempotent reports whether the request method is idempotent per RFC 7231, and so safe to replay on
+// retry: GET, HEAD, PUT, DELETE, OPTIONS and TRACE. POST, PATCH and unknown methods are not.
+func (un *Uncurl) IsIdempotent() bool {
+	switch strings.ToUpper(un.method) {
+	case `GET`, `HEAD`, `PUT`, `DELETE`, `OPTIONS`, `TRACE`:
+		return true
+	}
+	return false
+}
+
+// IsSecure reports whether the target uses https, so callers can refuse to replay over plain http
+func (un *Uncurl) IsSecure() bool {
+	u, err := url.Parse(un.target)
+	return err == nil && strings.EqualFold(u.Scheme, "https")
+}
+
+// NeedsGetBody reports whether the request has a body that would have to be replayed if it were
+// redirected with a 307 or 308 or retried, so callers know to set GetBody or buffer the body up front.
+// GET and HEAD bodies are not counted, as servers ignore them and clients drop them on redirect.
+func (un *Uncurl) NeedsGetBody() bool {
+	if len(un.body) == 0 {
+		return false
+	}
+	switch strings.ToUpper(un.method) {
+	case `GET`, `HEAD`:
+		return false
+	}
+	return true
+}
+
+// PathSegments returns the decoded, non-empty segments of the target's path, e.g. ["forecast", "us",
+// "ma", "waltham"] for https://www.wunderground.com/forecast/us/ma/waltham
+func (un *Uncurl) PathSegments() []string {
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return nil
+	}
+	var segs []string
+	for _, s := range strings.Split(u.EscapedPath(), "/") {
+		if s == "" {
+			continue
+		}
+		if d, err := url.PathUnescape(s); err == nil {
+			s = d
+		}
+		segs = append(segs, s)
+	}
+	return segs
+}
+
+// RewriteHost points the target at host, which may include a port, keeping the scheme, path and query.
+// A captured Host or authority header naming the old host is rewritten to match.
+func (un *Uncurl) RewriteHost(host string) error {
+	if host == "" || strings.ContainsAny(host, "/?#@") {
+		return fmt.Errorf("Invalid host %q", host)
+	}
+	u, err := url.Parse(un.target)
+	if err != nil {
+		return fmt.Errorf("Target url %s failed to parse: %s", un.target, err)
+	}
+	old := u.Host
+	u.Host = host
+	if err := un.checkTarget(u.String()); err != nil {
+		return err
+	}
+	un.target = u.String()
+	for k, v := range un.header {
+		lk := strings.ToLower(k)
+		if (lk == "host" || lk == "authority" || lk == ":authority") && len(v) == 1 && strings.EqualFold(v[0], old) {
+			un.header[k] = []string{host}
+		}
+	}
+	return nil
+}
+
+// RewriteHostAll applies RewriteHost to each Uncurl in us, e.g. to replay a capture against another
+// environment. It stops at the first failure, returning an error naming its index.
+func RewriteHostAll(us []*Uncurl, host string) error {
+	for i, un := range us {
+		if err := un.RewriteHost(host); err != nil {
+			return fmt.Errorf("Failed to rewrite host of request %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// RequireHeaders returns an error naming every header in keys that was not captured, compared
+// case-insensitively, or nil if all are present. A captured Accept-Encoding counts even when it is
+// held in AcceptEncoding rather than the header map.
+func (un *Uncurl) RequireHeaders(keys ...string) error {
+	var missing []string
+	for _, k := range keys {
+		if un.headerValues(k) != nil || (curlAcceptEncodingRe.MatchString(k) && un.AcceptEncoding != "") {
+			continue
+		}
+		missing = append(missing, k)
+	}
+	if missing != nil {
+		return fmt.Errorf("Missing required headers: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}